@@ -1,54 +1,98 @@
 package score
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 )
 
+// DefaultScorerTimeout is how long each scorer is given during aggregation unless ScorerTimeouts says otherwise
+const DefaultScorerTimeout = HTTPTimeout
+
+// ScorerTimeouts maps a scorer's machine name to how long it's given during aggregation, zero or less means no limit
+type ScorerTimeouts map[string]time.Duration
+
 // AggregatedLinkScores computes aggregate scores from multiple link scorers
 type AggregatedLinkScores struct {
-	MachineName            string       `json:"scorer"`
-	HumanName              string       `json:"scorerName"`
-	Simulated              bool         `json:"isSimulated,omitempty"`
-	URL                    string       `json:"url"`
-	GloballyUniqueKey      string       `json:"uniqueKey"`
-	AggregateSharesCount   int          `json:"aggregateSharesCount"`
-	AggregateCommentsCount int          `json:"aggregateCommentsCount"`
-	Scores                 []LinkScores `json:"scores"`
+	MachineName            string             `json:"scorer"`
+	HumanName              string             `json:"scorerName"`
+	Simulated              bool               `json:"isSimulated,omitempty"`
+	URL                    string             `json:"url"`
+	GloballyUniqueKey      string             `json:"uniqueKey"`
+	AggregateSharesCount   int                `json:"aggregateSharesCount"`
+	AggregateCommentsCount int                `json:"aggregateCommentsCount"`
+	AggregateMetrics       Metrics            `json:"metrics"`
+	Composite              *CompositeScore    `json:"composite,omitempty"`      // only computed when the aggregator has composite weights
+	NetworkSources         map[Network]string `json:"networkSources,omitempty"` // the scorer whose counts were used for each network
+	Scores                 []LinkScores       `json:"scores"`
+	IssueCollection        `json:"-"`         // the aggregate's own Issues plus every scorer's, only its own are serialized as "issues" by MarshalJSON
 
-	issues []Issue
+	validity ValidityPolicy // nil means DefaultValidityPolicy, serialized as "validity" if it's an IssueValidityPolicy
 }
 
 // GetAggregatedLinkScores returns a multiple scores structure
 func GetAggregatedLinkScores(url *url.URL, client *http.Client, initialTotalCount int, simulate bool) *AggregatedLinkScores {
+	return GetAggregatedLinkScoresWithContext(context.Background(), url, client, initialTotalCount, simulate)
+}
+
+// GetAggregatedLinkScoresWithContext returns a multiple scores structure, provider API calls are aborted if ctx is done
+func GetAggregatedLinkScoresWithContext(ctx context.Context, url *url.URL, client *http.Client, initialTotalCount int, simulate bool) *AggregatedLinkScores {
+	return GetAggregatedLinkScoresWithTimeouts(ctx, url, client, initialTotalCount, simulate, nil)
+}
+
+// GetAggregatedLinkScoresWithTimeouts returns a multiple scores structure, each provider is run concurrently and
+// given its own timeout (DefaultScorerTimeout if it's not in timeouts)
+func GetAggregatedLinkScoresWithTimeouts(ctx context.Context, url *url.URL, client *http.Client, initialTotalCount int, simulate bool, timeouts ScorerTimeouts) *AggregatedLinkScores {
+	aggregator := NewAggregator(
+		WithHTTPClient(client),
+		WithFacebook(simulate),
+		WithLinkedIn(simulate),
+		WithScorerTimeouts(timeouts),
+		WithInitialTotalCount(initialTotalCount))
+	return aggregator.Aggregate(ctx, url)
+}
+
+func aggregateLinkScores(ctx context.Context, url *url.URL, a *Aggregator) *AggregatedLinkScores {
+	initialTotalCount := a.initialTotalCount
 	result := new(AggregatedLinkScores)
-	result.MachineName = "aggregate"
+	result.MachineName = AggregateScorerMachineName
 	result.HumanName = "Aggregate"
-	result.Simulated = simulate
-	result.URL = url.String()
-
-	if fb, fbErr := GetFacebookLinkScoresForURL(url, client, simulate); fbErr == nil {
-		result.Scores = append(result.Scores, fb)
-		if fb.Issues() != nil {
-			for _, issue := range fb.Issues().ErrorsAndWarnings() {
-				result.issues = append(result.issues, issue)
-			}
-		}
+	result.Simulated = a.simulated
+	result.validity = a.validity
+	if url != nil {
+		result.URL = url.String()
 	}
-	if li, liErr := GetLinkedInLinkScoresForURL(url, client, simulate); liErr == nil {
-		result.Scores = append(result.Scores, li)
-		if li.Issues() != nil {
-			for _, issue := range li.Issues().ErrorsAndWarnings() {
-				result.issues = append(result.issues, issue)
-			}
+
+	// outcomes are kept in the same order as scorers no matter which one finishes first
+	for _, outcome := range scoreConcurrently(ctx, url, a.scorers, a.timeouts) {
+		if outcome.issue != nil {
+			result.AddFromProvider(outcome.provider, outcome.issue)
+		}
+		if outcome.scores != nil {
+			result.Scores = append(result.Scores, outcome.scores)
 		}
 	}
+	result.mergeScoresIssues()
+
+	// when scorers overlap (e.g. SharedCount re-reports Facebook and LinkedIn) only one source per network is counted
+	metrics, overlapped, sources := selectAuthoritativeMetrics(collectMetrics(result.Scores), a.scorerPrecedence, a.networkPrecedence)
+	if len(sources) > 0 {
+		result.NetworkSources = sources
+	}
 
 	result.AggregateSharesCount = initialTotalCount   // this is often set to -1 to signify "uncalculated" or similar
 	result.AggregateCommentsCount = initialTotalCount // this is often set to -1 to signify "uncalculated" or similar
-	for _, scorer := range result.Scores {
-		if scorer.IsValid() {
-			shares := scorer.SharesCount()
+	for i, scorer := range result.Scores {
+		if scoresValidUnder(validityOrDefault(a.validity), scorer) {
+			// each scorer's counts, less everything it counted for networks another scorer is authoritative for
+			overlappedComments, _ := overlapped[i].Value(CommentsMetric)
+			shares := scorer.SharesCount() - overlappedSharesCount(scorer, overlapped[i])
+			comments := scorer.CommentsCount() - overlappedComments
+
 			if shares > 0 {
 				if result.AggregateSharesCount == initialTotalCount {
 					result.AggregateSharesCount = shares
@@ -57,7 +101,6 @@ func GetAggregatedLinkScores(url *url.URL, client *http.Client, initialTotalCoun
 				}
 			}
 
-			comments := scorer.CommentsCount()
 			if comments > 0 {
 				if result.AggregateCommentsCount == initialTotalCount {
 					result.AggregateCommentsCount = comments
@@ -68,9 +111,90 @@ func GetAggregatedLinkScores(url *url.URL, client *http.Client, initialTotalCoun
 		}
 	}
 
+	result.AggregateMetrics = sumMetrics(metrics)
+	if a.compositeWeights != nil {
+		result.Composite = computeCompositeScore(metrics, a.compositeWeights)
+	}
+
 	return result
 }
 
+type scorerOutcome struct {
+	provider string
+	scores   LinkScores
+	issue    Issue
+}
+
+func (t ScorerTimeouts) timeout(machineName string) time.Duration {
+	if timeout, ok := t[machineName]; ok {
+		return timeout
+	}
+	return DefaultScorerTimeout
+}
+
+// scoreConcurrently runs all the scorers in parallel and returns their outcomes in the same order as scorers
+func scoreConcurrently(ctx context.Context, url *url.URL, scorers []Scorer, timeouts ScorerTimeouts) []scorerOutcome {
+	outcomes := make([]scorerOutcome, len(scorers))
+	var wg sync.WaitGroup
+	for i, scorer := range scorers {
+		wg.Add(1)
+		go func(i int, scorer Scorer) {
+			defer wg.Done()
+			outcomes[i] = scoreWithTimeout(ctx, url, scorer, timeouts.timeout(scorer.MachineName()))
+			outcomes[i].provider = scorer.MachineName()
+		}(i, scorer)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// scoreWithTimeout gives up on the scorer once the timeout elapses, even if the scorer itself doesn't honor its context
+func scoreWithTimeout(ctx context.Context, url *url.URL, scorer Scorer, timeout time.Duration) scorerOutcome {
+	var scorerCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		scorerCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		scorerCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	location := IssueContext{Provider: scorer.MachineName()}
+	if url != nil {
+		location.TargetURL = url.String()
+	}
+
+	done := make(chan scorerOutcome, 1)
+	go func() {
+		// a panicking scorer only fails its own outcome, not the whole aggregate or batch
+		defer func() {
+			if r := recover(); r != nil {
+				cause, _ := r.(error)
+				done <- scorerOutcome{issue: NewIssueWithContext(location, ScorerPanicked, fmt.Sprintf("%s scorer panicked: %v", scorer.HumanName(), r), true, cause)}
+			}
+		}()
+		scores, issue := scorer.ScoreLinkWithContext(scorerCtx, url)
+		done <- scorerOutcome{scores: scores, issue: issue}
+	}()
+
+	select {
+	case outcome := <-done:
+		return outcome
+	case <-scorerCtx.Done():
+		select {
+		case outcome := <-done:
+			return outcome
+		default:
+		}
+		if ctx.Err() == nil && scorerCtx.Err() == context.DeadlineExceeded {
+			return scorerOutcome{issue: NewIssueWithContext(location, ScoringDeadlineExceeded, fmt.Sprintf("%s scorer did not finish within %v", scorer.HumanName(), timeout), true, scorerCtx.Err())}
+		}
+		return scorerOutcome{issue: updateIssueContext(newContextIssue("", scorerCtx.Err()), func(c *IssueContext) {
+			c.Provider = location.Provider
+			c.TargetURL = location.TargetURL
+		})}
+	}
+}
+
 // SourceID returns the name of the scoring engine
 func (a AggregatedLinkScores) SourceID() string {
 	return a.MachineName
@@ -81,14 +205,15 @@ func (a AggregatedLinkScores) TargetURL() string {
 	return a.URL
 }
 
-// IsValid returns true if the FacebookLinkScoreGraphResult object is valid (did not return Facebook error object)
+// IsValid returns true if the aggregate is valid under the aggregator's ValidityPolicy, by default every scorer must
+// have finished and returned valid scores
 func (a AggregatedLinkScores) IsValid() bool {
-	for _, scorer := range a.Scores {
-		if !scorer.IsValid() {
-			return false
-		}
-	}
-	return true
+	return a.ValidUnder(a.validity)
+}
+
+// ValidUnder returns true if the aggregate is valid under the policy, e.g. to judge reloaded scores by a quorum
+func (a AggregatedLinkScores) ValidUnder(policy ValidityPolicy) bool {
+	return validityOrDefault(policy).IsAggregateValid(&a.IssueCollection, a.Scores)
 }
 
 // SharesCount is the count of how many times the given URL was shared by this scorer, -1 if invalid or not available
@@ -101,43 +226,50 @@ func (a AggregatedLinkScores) CommentsCount() int {
 	return a.AggregateCommentsCount
 }
 
-// Issues contains all the problems detected in scoring
-func (a AggregatedLinkScores) Issues() Issues {
-	return a
+// Metrics returns each metric summed separately across all the valid scorers
+func (a AggregatedLinkScores) Metrics() Metrics {
+	return a.AggregateMetrics
 }
 
-// ErrorsAndWarnings contains the problems in this link plus satisfies the Link.Issues interface
-func (a AggregatedLinkScores) ErrorsAndWarnings() []Issue {
-	return a.issues
+// mergeScoresIssues appends every scorer's Issues, in the same order as the Scores, after the aggregate's own
+func (a *AggregatedLinkScores) mergeScoresIssues() {
+	for _, scores := range a.Scores {
+		a.Merge(scores.SourceID(), scores.Issues())
+	}
 }
 
-// IssueCounts returns the total, errors, and warnings counts
-func (a AggregatedLinkScores) IssueCounts() (uint, uint, uint) {
-	if a.issues == nil {
-		return 0, 0, 0
-	}
-	var errors, warnings uint
-	for _, i := range a.issues {
-		if i.IsError() {
-			errors++
-		} else {
-			warnings++
-		}
-	}
-	return uint(len(a.issues)), errors, warnings
+// MarshalJSON adds the aggregate's own Issues and its validity policy, if it can be serialized, to the serialized
+// scores; each scorer's Issues are serialized with its scores rather than repeated
+func (a AggregatedLinkScores) MarshalJSON() ([]byte, error) {
+	type plain AggregatedLinkScores
+	return marshalWithIssues(plain(a), a.own(), a.validity)
 }
 
-// HandleIssues loops through each issue and calls a particular handler
-func (a AggregatedLinkScores) HandleIssues(errorHandler func(Issue), warningHandler func(Issue)) {
-	if a.issues == nil {
-		return
+// UnmarshalJSON rebuilds the concrete Issues and decodes each of the Scores into its provider's type, then merges
+// the scorers' Issues back into the aggregate's
+func (a *AggregatedLinkScores) UnmarshalJSON(data []byte) error {
+	type plain AggregatedLinkScores
+	aux := struct {
+		*plain
+		Scores []json.RawMessage `json:"scores"`
+	}{plain: (*plain)(a)}
+	a.IssueCollection = IssueCollection{}
+	if err := unmarshalWithIssues(data, &aux, &a.IssueCollection, &a.validity); err != nil {
+		return err
 	}
-	for _, i := range a.issues {
-		if i.IsError() && errorHandler != nil {
-			errorHandler(i)
-		}
-		if i.IsWarning() && warningHandler != nil {
-			warningHandler(i)
+	a.Scores = nil
+	for _, raw := range aux.Scores {
+		scores, err := UnmarshalLinkScores(raw)
+		if err != nil {
+			return err
 		}
+		a.Scores = append(a.Scores, scores)
 	}
+	a.mergeScoresIssues()
+	return nil
+}
+
+// Issues contains all the problems detected in scoring
+func (a AggregatedLinkScores) Issues() Issues {
+	return &a.IssueCollection
 }
@@ -0,0 +1,243 @@
+package score
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AggregateScorerMachineName is the machine name of the aggregate scorer
+const AggregateScorerMachineName = "aggregate"
+
+// Aggregator scores links with a configurable set of scorers and aggregates their results, it satisfies the Scorer interface
+type Aggregator struct {
+	client            *http.Client
+	policies          ProviderPolicies
+	providerPolicies  map[string]ProviderPolicies
+	baseURLs          map[string]string
+	factories         []func(*Aggregator) Scorer
+	scorers           []Scorer
+	timeouts          ScorerTimeouts
+	initialTotalCount int
+	simulated         bool
+	compositeWeights  CompositeWeights
+	scorerPrecedence  []string
+	networkPrecedence NetworkPrecedence
+	batchConcurrency  int
+	middleware        []Middleware
+	validity          ValidityPolicy
+}
+
+// AggregatorOption configures an Aggregator created by NewAggregator
+type AggregatorOption func(*Aggregator)
+
+// NewAggregator creates an aggregator from the options, scorers are run in the order their options are given
+func NewAggregator(options ...AggregatorOption) *Aggregator {
+	result := new(Aggregator)
+	result.timeouts = make(ScorerTimeouts)
+	result.initialTotalCount = -1
+	result.scorerPrecedence = DefaultScorerPrecedence
+	result.networkPrecedence = make(NetworkPrecedence)
+	result.providerPolicies = make(map[string]ProviderPolicies)
+	result.baseURLs = make(map[string]string)
+	for _, option := range options {
+		option(result)
+	}
+	for _, factory := range result.factories {
+		result.scorers = append(result.scorers, Chain(factory(result), result.middleware...))
+	}
+	return result
+}
+
+// WithHTTPClient sets the HTTP client given to the built-in providers, nil means the package default
+func WithHTTPClient(client *http.Client) AggregatorOption {
+	return func(a *Aggregator) {
+		a.client = client
+	}
+}
+
+// WithRetryPolicy sets the retry policy given to the built-in providers, nil (the default) means no retries
+func WithRetryPolicy(policy *RetryPolicy) AggregatorOption {
+	return func(a *Aggregator) {
+		a.policies.Retry = policy
+	}
+}
+
+// WithCachePolicy sets the response cache policy given to the built-in providers, nil (the default) means no caching
+func WithCachePolicy(policy *CachePolicy) AggregatorOption {
+	return func(a *Aggregator) {
+		a.policies.Cache = policy
+	}
+}
+
+// WithValidityPolicy decides whether the aggregate and the built-in providers' scores are valid, e.g.
+// QuorumValidityPolicy(2) keeps the aggregate valid when only one of three providers fails
+func WithValidityPolicy(policy ValidityPolicy) AggregatorOption {
+	return func(a *Aggregator) {
+		a.validity = policy
+		a.policies.Validity = policy
+	}
+}
+
+// WithProviderPolicies gives the named built-in provider its own policies instead of the aggregator-wide ones, a nil
+// Validity means the provider's scores are judged by the aggregator's ValidityPolicy
+func WithProviderPolicies(machineName string, policies ProviderPolicies) AggregatorOption {
+	return func(a *Aggregator) {
+		a.providerPolicies[machineName] = policies
+	}
+}
+
+// WithBaseURL points the named built-in provider at a different API base URL (test server, proxy, regional mirror, etc.)
+func WithBaseURL(machineName string, baseURL string) AggregatorOption {
+	return func(a *Aggregator) {
+		a.baseURLs[machineName] = baseURL
+	}
+}
+
+func (a *Aggregator) policiesFor(machineName string) ProviderPolicies {
+	if policies, ok := a.providerPolicies[machineName]; ok {
+		if policies.Validity == nil {
+			policies.Validity = a.policies.Validity
+		}
+		return policies
+	}
+	return a.policies
+}
+
+// WithFacebook adds the Facebook scorer
+func WithFacebook(simulateFacebookAPI bool) AggregatorOption {
+	return func(a *Aggregator) {
+		a.simulated = a.simulated || simulateFacebookAPI
+		a.factories = append(a.factories, func(a *Aggregator) Scorer {
+			scorer := NewFacebookScorer(a.client, simulateFacebookAPI)
+			scorer.BaseURL = a.baseURLs[FacebookScorerMachineName]
+			scorer.ProviderPolicies = a.policiesFor(FacebookScorerMachineName)
+			return scorer
+		})
+	}
+}
+
+// WithLinkedIn adds the LinkedIn scorer
+func WithLinkedIn(simulateLinkedInAPI bool) AggregatorOption {
+	return func(a *Aggregator) {
+		a.simulated = a.simulated || simulateLinkedInAPI
+		a.factories = append(a.factories, func(a *Aggregator) Scorer {
+			scorer := NewLinkedInScorer(a.client, simulateLinkedInAPI)
+			scorer.BaseURL = a.baseURLs[LinkedInScorerMachineName]
+			scorer.ProviderPolicies = a.policiesFor(LinkedInScorerMachineName)
+			return scorer
+		})
+	}
+}
+
+// WithSharedCount adds the SharedCount.com scorer using the given credentials
+func WithSharedCount(creds SharedCountCredentials, simulateSharedCountAPI bool) AggregatorOption {
+	return func(a *Aggregator) {
+		a.simulated = a.simulated || simulateSharedCountAPI
+		a.factories = append(a.factories, func(a *Aggregator) Scorer {
+			scorer := NewSharedCountScorer(creds, a.client, simulateSharedCountAPI)
+			scorer.BaseURL = a.baseURLs[SharedCountScorerMachineName]
+			scorer.ProviderPolicies = a.policiesFor(SharedCountScorerMachineName)
+			return scorer
+		})
+	}
+}
+
+// WithScorer adds an already configured scorer, such as an in-house one
+func WithScorer(scorer Scorer) AggregatorOption {
+	return func(a *Aggregator) {
+		a.factories = append(a.factories, func(*Aggregator) Scorer {
+			return scorer
+		})
+	}
+}
+
+// WithRegistry adds the scorers which are enabled in the registry at the time the option is applied
+func WithRegistry(registry *Registry) AggregatorOption {
+	return func(a *Aggregator) {
+		for _, scorer := range registry.EnabledScorers() {
+			WithScorer(scorer)(a)
+		}
+	}
+}
+
+// WithScorerTimeout sets how long the named scorer is given, zero or less means no limit
+func WithScorerTimeout(machineName string, timeout time.Duration) AggregatorOption {
+	return func(a *Aggregator) {
+		a.timeouts[machineName] = timeout
+	}
+}
+
+// WithScorerTimeouts sets how long each of the named scorers is given
+func WithScorerTimeouts(timeouts ScorerTimeouts) AggregatorOption {
+	return func(a *Aggregator) {
+		for machineName, timeout := range timeouts {
+			a.timeouts[machineName] = timeout
+		}
+	}
+}
+
+// WithInitialTotalCount sets the aggregate counts' starting value, -1 (the default) signifies "uncalculated"
+func WithInitialTotalCount(initialTotalCount int) AggregatorOption {
+	return func(a *Aggregator) {
+		a.initialTotalCount = initialTotalCount
+	}
+}
+
+// WithCompositeWeights computes a weighted composite score for each aggregate
+func WithCompositeWeights(weights CompositeWeights) AggregatorOption {
+	return func(a *Aggregator) {
+		a.compositeWeights = weights
+	}
+}
+
+// WithScorerPrecedence ranks scorers (by machine name) when more than one reports the same network, the first is
+// the most authoritative; it replaces DefaultScorerPrecedence
+func WithScorerPrecedence(machineNames ...string) AggregatorOption {
+	return func(a *Aggregator) {
+		a.scorerPrecedence = machineNames
+	}
+}
+
+// WithNetworkPrecedence ranks scorers (by machine name) for a single network, overriding the scorer precedence
+func WithNetworkPrecedence(network Network, machineNames ...string) AggregatorOption {
+	return func(a *Aggregator) {
+		a.networkPrecedence[network] = machineNames
+	}
+}
+
+// Scorers returns the scorers which are aggregated, in the order they are run
+func (a *Aggregator) Scorers() []Scorer {
+	result := make([]Scorer, len(a.scorers))
+	copy(result, a.scorers)
+	return result
+}
+
+// Aggregate runs every scorer concurrently against the URL and aggregates the results
+func (a *Aggregator) Aggregate(ctx context.Context, url *url.URL) *AggregatedLinkScores {
+	return aggregateLinkScores(ctx, url, a)
+}
+
+// MachineName returns the name the scorer is registered under
+func (a *Aggregator) MachineName() string {
+	return AggregateScorerMachineName
+}
+
+// HumanName returns the display name of the scorer
+func (a *Aggregator) HumanName() string {
+	return "Aggregate"
+}
+
+// ScoreLink satisfies the Lifecycle interface
+func (a *Aggregator) ScoreLink(url *url.URL) (LinkScores, Issue) {
+	return a.ScoreLinkWithContext(context.Background(), url)
+}
+
+// ScoreLinkWithContext satisfies the ContextLifecycle interface
+func (a *Aggregator) ScoreLinkWithContext(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+	if url == nil {
+		return nil, NewIssueWithContext(IssueContext{Provider: a.MachineName()}, NoURLProvidedToScorer, "Null URL passed to Aggregator.ScoreLink", true, nil)
+	}
+	return a.Aggregate(ctx, url), nil
+}
@@ -0,0 +1,90 @@
+package score
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// DefaultBatchConcurrency is how many URLs are aggregated at the same time unless WithBatchConcurrency says otherwise
+const DefaultBatchConcurrency = 8
+
+// BatchFailure identifies a URL whose aggregate was invalid and the Issue codes which made it so, i.e. the codes of
+// Issues which invalidate scores under the aggregate's ValidityPolicy (warnings and ignored codes aren't included)
+type BatchFailure struct {
+	URL        string   `json:"url"`
+	IssueCodes []string `json:"issueCodes"`
+}
+
+// BatchLinkScores holds one aggregate per URL, in the same order as the URLs, and a summary of which ones failed
+type BatchLinkScores struct {
+	Results  []*AggregatedLinkScores `json:"results"`
+	Failures []BatchFailure          `json:"failures,omitempty"`
+}
+
+// WithBatchConcurrency limits how many URLs AggregateBatch scores at the same time
+func WithBatchConcurrency(concurrency int) AggregatorOption {
+	return func(a *Aggregator) {
+		a.batchConcurrency = concurrency
+	}
+}
+
+// AggregateBatch aggregates the scores of every URL, each URL is isolated so one failing doesn't affect the others
+func (a *Aggregator) AggregateBatch(ctx context.Context, urls []*url.URL) *BatchLinkScores {
+	concurrency := a.batchConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	result := new(BatchLinkScores)
+	result.Results = make([]*AggregatedLinkScores, len(urls))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, u *url.URL) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result.Results[i] = a.Aggregate(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	for _, aggregated := range result.Results {
+		if aggregated.IsValid() {
+			continue
+		}
+		failure := BatchFailure{URL: aggregated.URL}
+		seen := make(map[string]bool)
+		for _, issue := range invalidatingIssues(validityOrDefault(aggregated.validity), &aggregated.IssueCollection) {
+			if !seen[issue.IssueCode()] {
+				seen[issue.IssueCode()] = true
+				failure.IssueCodes = append(failure.IssueCodes, issue.IssueCode())
+			}
+		}
+		result.Failures = append(result.Failures, failure)
+	}
+	return result
+}
+
+// SucceededCount returns how many URLs were scored without failing
+func (b BatchLinkScores) SucceededCount() int {
+	return len(b.Results) - len(b.Failures)
+}
+
+// FailedCount returns how many URLs failed
+func (b BatchLinkScores) FailedCount() int {
+	return len(b.Failures)
+}
+
+// IssueCodeCounts returns how many failed URLs had each Issue code
+func (b BatchLinkScores) IssueCodeCounts() map[string]int {
+	result := make(map[string]int)
+	for _, failure := range b.Failures {
+		for _, code := range failure.IssueCodes {
+			result[code]++
+		}
+	}
+	return result
+}
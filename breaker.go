@@ -0,0 +1,238 @@
+package score
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "halfOpen"
+)
+
+// CircuitBreakerSettings configures when a CircuitBreaker opens and how it recovers, zero fields are taken from
+// DefaultCircuitBreakerSettings
+type CircuitBreakerSettings struct {
+	WindowSize           int           // how many of the most recent calls the failure rate is computed over
+	MinimumCalls         int           // calls needed in the window before the circuit may open
+	FailureRateThreshold float64       // fraction (0 to 1) of failed calls in the window which opens the circuit
+	CoolDown             time.Duration // how long the circuit stays open before half-opening
+	HalfOpenProbes       int           // probe calls let through while half-open, all must succeed to close the circuit
+}
+
+// DefaultCircuitBreakerSettings opens after half of the last 20 calls (at least 5) fail and probes again after a minute
+var DefaultCircuitBreakerSettings = CircuitBreakerSettings{
+	WindowSize:           20,
+	MinimumCalls:         5,
+	FailureRateThreshold: 0.5,
+	CoolDown:             time.Minute,
+	HalfOpenProbes:       1,
+}
+
+// CircuitBreakerStatus is a snapshot of a CircuitBreaker, suitable for dashboards
+type CircuitBreakerStatus struct {
+	Name             string       `json:"name"`
+	State            CircuitState `json:"state"`
+	WindowCalls      int          `json:"windowCalls"`
+	WindowFailures   int          `json:"windowFailures"`
+	FailureRate      float64      `json:"failureRate"`
+	OpenedAt         time.Time    `json:"openedAt,omitempty"`
+	HalfOpensAt      time.Time    `json:"halfOpensAt,omitempty"`
+	TotalCalls       uint64       `json:"totalCalls"`
+	TotalFailures    uint64       `json:"totalFailures"`
+	TotalRejected    uint64       `json:"totalRejected"`
+	TotalTimesOpened uint64       `json:"totalTimesOpened"`
+}
+
+// CircuitBreaker stops calling a provider which keeps failing, share one instance across all the scorers which
+// call the same provider; it's safe for concurrent use
+type CircuitBreaker struct {
+	mutex          sync.Mutex
+	name           string
+	settings       CircuitBreakerSettings
+	state          CircuitState
+	window         []bool // true for each failed call, used as a ring buffer
+	next           int
+	openedAt       time.Time
+	probesInFlight int
+	probeSuccesses int
+	generation     uint64               // bumped on every state change so outcomes of calls allowed in an earlier state are ignored
+	status         CircuitBreakerStatus // only the Total* counters are maintained here
+}
+
+// callOutcome is how a call guarded by a CircuitBreaker turned out
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	callIgnored // e.g. cancelled by the caller, says nothing about the provider's health
+)
+
+// callPermit is handed out by allow for each call let through and must be passed back to record
+type callPermit struct {
+	probe      bool
+	generation uint64
+}
+
+// NewCircuitBreaker creates a closed circuit breaker, the name is only used for reporting
+func NewCircuitBreaker(name string, settings CircuitBreakerSettings) *CircuitBreaker {
+	if settings.WindowSize < 1 {
+		settings.WindowSize = DefaultCircuitBreakerSettings.WindowSize
+	}
+	if settings.MinimumCalls < 1 {
+		settings.MinimumCalls = DefaultCircuitBreakerSettings.MinimumCalls
+	}
+	if settings.FailureRateThreshold <= 0 {
+		settings.FailureRateThreshold = DefaultCircuitBreakerSettings.FailureRateThreshold
+	}
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = DefaultCircuitBreakerSettings.CoolDown
+	}
+	if settings.HalfOpenProbes < 1 {
+		settings.HalfOpenProbes = DefaultCircuitBreakerSettings.HalfOpenProbes
+	}
+	result := new(CircuitBreaker)
+	result.name = name
+	result.settings = settings
+	result.state = CircuitClosed
+	return result
+}
+
+// State returns the current state, an open circuit whose cool-down is over reports as half-open
+func (b *CircuitBreaker) State() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.advance(time.Now())
+	return b.state
+}
+
+// Status returns a snapshot of the breaker's state and counters
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.advance(time.Now())
+	result := b.status
+	result.Name = b.name
+	result.State = b.state
+	result.WindowCalls = len(b.window)
+	for _, failed := range b.window {
+		if failed {
+			result.WindowFailures++
+		}
+	}
+	if result.WindowCalls > 0 {
+		result.FailureRate = float64(result.WindowFailures) / float64(result.WindowCalls)
+	}
+	if b.state != CircuitClosed {
+		result.OpenedAt = b.openedAt
+		result.HalfOpensAt = b.openedAt.Add(b.settings.CoolDown)
+	}
+	return result
+}
+
+// advance half-opens the circuit once the cool-down is over, the mutex must be held
+func (b *CircuitBreaker) advance(now time.Time) {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.settings.CoolDown {
+		b.state = CircuitHalfOpen
+		b.generation++
+		b.probesInFlight = 0
+		b.probeSuccesses = 0
+	}
+}
+
+// allow returns a ProviderUnavailable Issue if the call should be short-circuited, otherwise the caller
+// must report the call's outcome by passing the permit to record
+func (b *CircuitBreaker) allow(apiEndpoint string) (callPermit, Issue) {
+	if b == nil {
+		return callPermit{}, nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.advance(time.Now())
+	permit := callPermit{generation: b.generation}
+	switch {
+	case b.state == CircuitOpen:
+	case b.state == CircuitHalfOpen && b.probesInFlight >= b.settings.HalfOpenProbes:
+	case b.state == CircuitHalfOpen:
+		b.probesInFlight++
+		permit.probe = true
+		return permit, nil
+	default:
+		return permit, nil
+	}
+	b.status.TotalRejected++
+	return permit, NewIssue(apiEndpoint, ProviderUnavailable, fmt.Sprintf("%s is unavailable, circuit breaker is %s until %v", b.name, b.state, b.openedAt.Add(b.settings.CoolDown).Format(time.RFC3339)), true)
+}
+
+// record updates the breaker with the outcome of a call which was allowed, a call allowed before the circuit last
+// changed state only counts towards the totals
+func (b *CircuitBreaker) record(permit callPermit, outcome callOutcome) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	stale := permit.generation != b.generation
+	if permit.probe && !stale {
+		b.probesInFlight--
+		switch outcome {
+		case callFailed:
+			b.open()
+		case callSucceeded:
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.settings.HalfOpenProbes {
+				b.state = CircuitClosed
+				b.generation++
+				b.window = nil
+				b.next = 0
+			}
+		}
+	}
+	if outcome == callIgnored {
+		return
+	}
+
+	b.status.TotalCalls++
+	if outcome == callFailed {
+		b.status.TotalFailures++
+	}
+	if stale || b.state != CircuitClosed {
+		return
+	}
+	if len(b.window) < b.settings.WindowSize {
+		b.window = append(b.window, outcome == callFailed)
+	} else {
+		b.window[b.next] = outcome == callFailed
+		b.next = (b.next + 1) % b.settings.WindowSize
+	}
+
+	if len(b.window) < b.settings.MinimumCalls {
+		return
+	}
+	var failures int
+	for _, failed := range b.window {
+		if failed {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(b.window)) >= b.settings.FailureRateThreshold {
+		b.open()
+	}
+}
+
+// open trips the circuit, the mutex must be held
+func (b *CircuitBreaker) open() {
+	b.state = CircuitOpen
+	b.generation++
+	b.openedAt = time.Now()
+	b.window = nil
+	b.next = 0
+	b.status.TotalTimesOpened++
+}
@@ -0,0 +1,197 @@
+package score
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CachedResponse is an API response body stored in a ResponseCache
+type CachedResponse struct {
+	Body     []byte    `json:"body"`
+	StoredAt time.Time `json:"storedAt"`
+}
+
+// ResponseCache stores API response bodies by API endpoint, implementations must be safe for concurrent use
+type ResponseCache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, response *CachedResponse)
+	Delete(key string)
+}
+
+// CachePolicy configures how a provider's API responses are cached
+type CachePolicy struct {
+	Cache      ResponseCache
+	TTL        time.Duration // how long a response is fresh, zero or less means forever
+	ServeStale bool          // serve expired responses immediately while refreshing them in the background
+}
+
+// revalidating keeps track of the background refreshes in progress so each key is only refreshed once at a time
+var revalidating sync.Map
+
+func (p *CachePolicy) lookup(key string) (*CachedResponse, bool, bool) {
+	if p == nil || p.Cache == nil {
+		return nil, false, false
+	}
+	cached, ok := p.Cache.Get(key)
+	if !ok || cached == nil {
+		return nil, false, false
+	}
+	fresh := p.TTL <= 0 || time.Since(cached.StoredAt) < p.TTL
+	return cached, true, fresh
+}
+
+func (p *CachePolicy) store(key string, body []byte) {
+	if p == nil || p.Cache == nil {
+		return
+	}
+	p.Cache.Set(key, &CachedResponse{Body: body, StoredAt: time.Now()})
+}
+
+// revalidate refreshes the cached response in the background, it's detached from the caller's context
+func (p *CachePolicy) revalidate(call *apiCall) {
+	inFlight := fmt.Sprintf("%p|%s", p.Cache, call.cacheKey())
+	if _, already := revalidating.LoadOrStore(inFlight, true); already {
+		return
+	}
+	go func() {
+		defer revalidating.Delete(inFlight)
+		refresh := *call
+		refresh.cache = nil
+		if httpRes, issue := getHTTPResult(context.Background(), &refresh); issue == nil && !httpRes.transient && call.isCacheable(*httpRes.body) {
+			p.store(call.cacheKey(), *httpRes.body)
+		}
+	}()
+}
+
+// MemoryCache is an in-memory least-recently-used ResponseCache
+type MemoryCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	recency  *list.List
+}
+
+type memoryCacheEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewMemoryCache creates an LRU cache which holds up to capacity responses, zero or less means no limit
+func NewMemoryCache(capacity int) *MemoryCache {
+	result := new(MemoryCache)
+	result.capacity = capacity
+	result.entries = make(map[string]*list.Element)
+	result.recency = list.New()
+	return result
+}
+
+// Get satisfies the ResponseCache interface
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.recency.MoveToFront(element)
+	return element.Value.(*memoryCacheEntry).response, true
+}
+
+// Set satisfies the ResponseCache interface
+func (c *MemoryCache) Set(key string, response *CachedResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*memoryCacheEntry).response = response
+		c.recency.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.recency.PushFront(&memoryCacheEntry{key: key, response: response})
+	if c.capacity > 0 && c.recency.Len() > c.capacity {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+// Delete satisfies the ResponseCache interface
+func (c *MemoryCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.recency.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Len returns how many responses are cached
+func (c *MemoryCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.recency.Len()
+}
+
+// DiskCache is a ResponseCache which keeps each response in its own file, so it survives across pipeline runs
+type DiskCache struct {
+	directory string
+}
+
+// NewDiskCache creates a disk cache in the directory, creating the directory if necessary
+func NewDiskCache(directory string) (*DiskCache, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create disk cache directory %q: %v", directory, err)
+	}
+	result := new(DiskCache)
+	result.directory = directory
+	return result, nil
+}
+
+// the key is hashed because endpoints aren't valid file names (and may contain API keys)
+func (c *DiskCache) fileName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.directory, hex.EncodeToString(hash[:])+".json")
+}
+
+// Get satisfies the ResponseCache interface, unreadable entries are treated as missing
+func (c *DiskCache) Get(key string) (*CachedResponse, bool) {
+	data, err := ioutil.ReadFile(c.fileName(key))
+	if err != nil {
+		return nil, false
+	}
+	result := new(CachedResponse)
+	if json.Unmarshal(data, result) != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+// Set satisfies the ResponseCache interface, failures to write are ignored since the cache is only an optimization
+func (c *DiskCache) Set(key string, response *CachedResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	temp, err := ioutil.TempFile(c.directory, "partial-")
+	if err != nil {
+		return
+	}
+	_, writeErr := temp.Write(data)
+	closeErr := temp.Close()
+	if writeErr != nil || closeErr != nil || os.Rename(temp.Name(), c.fileName(key)) != nil {
+		os.Remove(temp.Name())
+	}
+}
+
+// Delete satisfies the ResponseCache interface
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.fileName(key))
+}
@@ -0,0 +1,135 @@
+package score
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IssueCodeInfo explains an Issue code to operators who haven't read the source
+type IssueCodeInfo struct {
+	Code        string        `json:"code"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Severity    IssueSeverity `json:"severity"` // the severity when the Issue is an error, the same code may also be a retry warning
+	Category    IssueCategory `json:"category,omitempty"`
+	Retryable   bool          `json:"retryable"` // whether trying the same call again later may succeed
+	Remediation string        `json:"remediation"`
+}
+
+var issueCatalog = struct {
+	sync.RWMutex
+	entries map[string]IssueCodeInfo
+}{entries: make(map[string]IssueCodeInfo)}
+
+func init() {
+	for _, info := range []IssueCodeInfo{
+		{UnableToCreateHTTPRequest, "Unable to create HTTP request", "The provider's API endpoint could not be turned into an HTTP request, usually because its base URL is malformed.",
+			FatalSeverity, UncategorizedIssue, false, "Check the scorer's BaseURL (or WithBaseURL option) is an absolute http or https URL."},
+		{UnableToExecuteHTTPGETRequest, "Unable to execute HTTP GET request", "The request never got an HTTP response, e.g. DNS resolution, the connection or the TLS handshake failed, or the client timed out.",
+			ErrorSeverity, NetworkIssue, true, "Check connectivity, DNS and proxy settings from this host to the provider; the wrapped error says which step failed."},
+		{InvalidAPIRespHTTPStatusCode, "Invalid API response HTTP status code", "The provider responded with a status other than 200 OK, the code's -HTTP-nnn suffix is the status.",
+			ErrorSeverity, UncategorizedIssue, false, "Look up the specific -HTTP-nnn code for status-specific advice."},
+		{UnableToReadBodyFromHTTPResponse, "Unable to read body from HTTP response", "The connection failed while the response body was being read.",
+			ErrorSeverity, NetworkIssue, true, "Usually transient; if it persists check for proxies or load balancers truncating responses."},
+		{APIErrorResponseFound, "API error response found", "The provider returned its own error object, its code and trace ID are kept as the Issue's provider code and trace ID.",
+			ErrorSeverity, UncategorizedIssue, false, "Look up the provider code in the provider's API documentation, quote the trace ID when contacting the provider."},
+		{NoAPIKeyProvidedInCodeOrEnv, "No API key provided", "The scorer needs an API key but none was given in code or found in the environment.",
+			FatalSeverity, AuthIssue, false, fmt.Sprintf("Set %s or pass SharedCountCredentials to the scorer.", SharedCountAPIKeyEnvVarName)},
+		{SecretManagementError, "Secret management error", "The API key could not be read from the secrets vault.",
+			FatalSeverity, AuthIssue, false, "Check the vault configuration and that this process can decrypt the stored secret."},
+		{NoURLProvidedToScorer, "No URL provided to scorer", "A nil URL was passed to ScoreLink.",
+			ErrorSeverity, UncategorizedIssue, false, "Fix the caller so it only scores parsed, non-nil URLs."},
+		{ScoringCancelled, "Scoring was cancelled", "The caller's context was cancelled before the scorer finished.",
+			ErrorSeverity, UncategorizedIssue, false, "None needed if the cancellation was intended, otherwise check what cancelled the context."},
+		{ScoringDeadlineExceeded, "Scoring deadline exceeded", "The scorer did not finish within its context deadline or its per-scorer timeout.",
+			ErrorSeverity, NetworkIssue, true, "Retry later, or raise the timeout with WithScorerTimeout or WithScorerTimeouts if the provider is consistently slow."},
+		{ScorerPanicked, "Scorer panicked", "The scorer panicked, the panic was recovered so only its own scores were lost.",
+			FatalSeverity, UncategorizedIssue, false, "This is a bug in the scorer, report it with the Issue's message."},
+		{RateLimitExceeded, "Rate limit exceeded", "The provider's client-side rate limiter had no token available and wasn't configured to wait.",
+			ErrorSeverity, QuotaIssue, true, "Retry later, lower the request rate, or configure the RateLimiter to wait for tokens."},
+		{ProviderUnavailable, "Provider unavailable", "The provider's circuit breaker is open after repeated failures so the call wasn't made.",
+			ErrorSeverity, NetworkIssue, true, "Wait for the breaker's cool down, check the breaker Status for the failures which opened it."},
+		{UnableToDecodeAPIResponseBody, "Unable to decode API response body", "The provider's response body isn't valid JSON for the expected structure.",
+			ErrorSeverity, DecodeIssue, false, "The provider may have changed its API; compare the response with the provider's current documentation."},
+		{UnexpectedAPIResponseBody, "Unexpected API response body", "The provider's response was valid JSON but was missing the fields scores are read from.",
+			ErrorSeverity, DecodeIssue, false, "The provider may have changed or retired the API; check its current documentation and deprecation notices."},
+	} {
+		RegisterIssueCode(info)
+	}
+}
+
+// RegisterIssueCode adds or replaces a catalog entry, custom scorers should register the codes they create
+func RegisterIssueCode(info IssueCodeInfo) {
+	issueCatalog.Lock()
+	defer issueCatalog.Unlock()
+	issueCatalog.entries[info.Code] = info
+}
+
+// LookupIssueCode returns the catalog entry for code, including the per-status codes created by NewHTTPResponseIssue
+func LookupIssueCode(code string) (IssueCodeInfo, bool) {
+	issueCatalog.RLock()
+	info, ok := issueCatalog.entries[code]
+	issueCatalog.RUnlock()
+	if ok {
+		return info, true
+	}
+	if suffix := InvalidAPIRespHTTPStatusCode + "-HTTP-"; strings.HasPrefix(code, suffix) {
+		if statusCode, err := strconv.Atoi(strings.TrimPrefix(code, suffix)); err == nil {
+			return httpStatusIssueCodeInfo(statusCode), true
+		}
+	}
+	return IssueCodeInfo{}, false
+}
+
+// DescribeIssue returns the catalog entry for the Issue's code
+func DescribeIssue(i Issue) (IssueCodeInfo, bool) {
+	return LookupIssueCode(i.IssueCode())
+}
+
+// IssueCatalog returns every registered code sorted by code, the per-status HTTP codes are described by LookupIssueCode
+func IssueCatalog() []IssueCodeInfo {
+	issueCatalog.RLock()
+	result := make([]IssueCodeInfo, 0, len(issueCatalog.entries))
+	for _, info := range issueCatalog.entries {
+		result = append(result, info)
+	}
+	issueCatalog.RUnlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	return result
+}
+
+// categoryFor returns the category of a code, HTTP status codes are categorized by their status
+func categoryFor(code string) IssueCategory {
+	if info, ok := LookupIssueCode(code); ok {
+		return info.Category
+	}
+	return UncategorizedIssue
+}
+
+func httpStatusIssueCodeInfo(statusCode int) IssueCodeInfo {
+	result := IssueCodeInfo{
+		Code:        fmt.Sprintf("%s-HTTP-%d", InvalidAPIRespHTTPStatusCode, statusCode),
+		Title:       fmt.Sprintf("HTTP %d %s", statusCode, http.StatusText(statusCode)),
+		Description: fmt.Sprintf("The provider responded with HTTP status %d instead of 200 OK.", statusCode),
+		Severity:    ErrorSeverity,
+		Category:    httpStatusCategory(statusCode),
+		Retryable:   isRetryableHTTPStatus(statusCode),
+	}
+	switch result.Category {
+	case AuthIssue:
+		result.Remediation = "Check the API key or access token is valid and has permission for this API."
+	case QuotaIssue:
+		result.Remediation = "Slow down: configure a RateLimiter for the provider and honor Retry-After, or raise the account's quota."
+	case ProviderDeprecatedIssue:
+		result.Remediation = "The API or API version has been retired, move the scorer's BaseURL to a supported version."
+	case NetworkIssue:
+		result.Remediation = "The provider is having problems; retry later and let the circuit breaker shed load meanwhile."
+	default:
+		result.Remediation = "Check the request against the provider's API documentation, the response body may explain the status."
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package score
+
+// AnyScorer may be used as the scorer key in CompositeWeights to weigh metrics from scorers without their own entry
+const AnyScorer = "*"
+
+// CompositeWeights maps a scorer's machine name (or AnyScorer) to the weight of each of its metrics,
+// metrics without a weight don't contribute to the composite score
+type CompositeWeights map[string]map[MetricName]float64
+
+// CompositeContribution explains how much one scorer's metric added to the composite score
+type CompositeContribution struct {
+	Scorer  string     `json:"scorer"`
+	Metric  MetricName `json:"metric"`
+	Network Network    `json:"network,omitempty"`
+	Value   int        `json:"value"`
+	Weight  float64    `json:"weight"`
+	Score   float64    `json:"score"`
+}
+
+// CompositeScore is a single weighted engagement number plus the breakdown of how it was computed
+type CompositeScore struct {
+	Score     float64                 `json:"score"`
+	Breakdown []CompositeContribution `json:"breakdown"`
+}
+
+// weight returns the weight for the scorer's metric, falling back to the AnyScorer weights
+func (w CompositeWeights) weight(machineName string, metric MetricName) (float64, bool) {
+	if metrics, ok := w[machineName]; ok {
+		if weight, ok := metrics[metric]; ok {
+			return weight, true
+		}
+	}
+	if metrics, ok := w[AnyScorer]; ok {
+		if weight, ok := metrics[metric]; ok {
+			return weight, true
+		}
+	}
+	return 0, false
+}
+
+// ComputeCompositeScore weighs every metric of every valid score and totals them
+func ComputeCompositeScore(scores []LinkScores, weights CompositeWeights) *CompositeScore {
+	return computeCompositeScore(collectMetrics(scores), weights)
+}
+
+func computeCompositeScore(metrics []sourcedMetric, weights CompositeWeights) *CompositeScore {
+	result := new(CompositeScore)
+	for _, sm := range metrics {
+		weight, ok := weights.weight(sm.scorer, sm.metric.Name)
+		if !ok {
+			continue
+		}
+		contribution := CompositeContribution{
+			Scorer:  sm.scorer,
+			Metric:  sm.metric.Name,
+			Network: sm.metric.Network,
+			Value:   sm.metric.Value,
+			Weight:  weight,
+			Score:   float64(sm.metric.Value) * weight,
+		}
+		result.Score += contribution.Score
+		result.Breakdown = append(result.Breakdown, contribution)
+	}
+	return result
+}
+
+// ScorerTotals returns how much each scorer contributed to the composite score
+func (c CompositeScore) ScorerTotals() map[string]float64 {
+	result := make(map[string]float64)
+	for _, contribution := range c.Breakdown {
+		result[contribution.Scorer] += contribution.Score
+	}
+	return result
+}
@@ -1,11 +1,14 @@
 package score
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
 // TODO: If Facebook rate limiting gets in the way, try https://github.com/ustayready/fireprox
@@ -16,18 +19,84 @@ const SimulateFacebookAPI = true
 // UseFacebookAPI is passed into GetFacebookGraphForURL* if we don't want to simulate the API, but actually run it
 const UseFacebookAPI = false
 
+// DefaultFacebookAPIBaseURL is the Facebook Graph API endpoint used when the scorer has no BaseURL
+const DefaultFacebookAPIBaseURL = "https://graph.facebook.com/"
+
+// FacebookScorerMachineName is the machine name the Facebook scorer registers under
+const FacebookScorerMachineName = "facebook"
+
+func init() {
+	DefaultRegistry.Register(NewFacebookScorer(nil, UseFacebookAPI))
+	RegisterLinkScoresType(FacebookScorerMachineName, func() LinkScores { return new(FacebookLinkScores) })
+}
+
+// FacebookScorer scores links using the Facebook Graph API and satisfies the Scorer interface
+type FacebookScorer struct {
+	Client   *http.Client
+	Simulate bool
+	BaseURL  string // empty means DefaultFacebookAPIBaseURL, set it to use a test server, proxy or mirror
+	ProviderPolicies
+}
+
+// NewFacebookScorer creates a Facebook scorer, a nil client means the package default HTTP client
+func NewFacebookScorer(client *http.Client, simulateFacebookAPI bool) *FacebookScorer {
+	result := new(FacebookScorer)
+	result.Client = client
+	result.Simulate = simulateFacebookAPI
+	return result
+}
+
+// MachineName returns the name the scorer is registered under
+func (s *FacebookScorer) MachineName() string {
+	return FacebookScorerMachineName
+}
+
+// HumanName returns the display name of the scorer
+func (s *FacebookScorer) HumanName() string {
+	return "Facebook"
+}
+
+// SensitiveParams satisfies the SensitiveParameters interface, the access token may be part of BaseURL
+func (s *FacebookScorer) SensitiveParams() []string {
+	return []string{"access_token", "appsecret_proof"}
+}
+
+// APIBaseURL returns the base URL the scorer's API calls are made to
+func (s *FacebookScorer) APIBaseURL() string {
+	if len(s.BaseURL) > 0 {
+		return s.BaseURL
+	}
+	return DefaultFacebookAPIBaseURL
+}
+
+// ScoreLink satisfies the Lifecycle interface
+func (s *FacebookScorer) ScoreLink(url *url.URL) (LinkScores, Issue) {
+	return s.ScoreLinkWithContext(context.Background(), url)
+}
+
+// ScoreLinkWithContext satisfies the ContextLifecycle interface
+func (s *FacebookScorer) ScoreLinkWithContext(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+	if url == nil {
+		return nil, NewIssueWithContext(IssueContext{Provider: s.MachineName()}, NoURLProvidedToScorer, "Null URL passed to FacebookScorer.ScoreLink", true, nil)
+	}
+	return s.scoreURLText(ctx, url.String()), nil
+}
+
 // FacebookLinkScores is the type-safe version of what Facebook API Graph returns
 type FacebookLinkScores struct {
-	MachineName string                 `json:"scorer"`
-	HumanName   string                 `json:"scorerName"`
-	Simulated   bool                   `json:"isSimulated,omitempty"` // part of lectio.score, omitted if it's false
-	URL         string                 `json:"url"`                   // part of lectio.score
-	APIEndpoint string                 `json:"apiEndPoint"`           // part of lectio.score
-	IssuesFound []Issue                `json:"issues"`                // part of lectio.score
-	APIError    *FacebookGraphAPIError `json:"error,omitempty"`       // direct mapping to Facebook API result via Unmarshal httpRes.Body
-	ID          string                 `json:"id"`                    // direct mapping to Facebook API result via Unmarshal httpRes.Body
-	Shares      *FacebookGraphShares   `json:"share"`                 // direct mapping to Facebook API result via Unmarshal httpRes.Body
-	OpenGraph   *FacebookGraphOGObject `json:"og_object"`             // direct mapping to Facebook API result via Unmarshal httpRes.Body
+	MachineName     string                 `json:"scorer"`
+	HumanName       string                 `json:"scorerName"`
+	Simulated       bool                   `json:"isSimulated,omitempty"` // part of lectio.score, omitted if it's false
+	URL             string                 `json:"url"`                   // part of lectio.score
+	APIEndpoint     string                 `json:"apiEndPoint"`           // part of lectio.score
+	APIAttempts     int                    `json:"apiAttempts,omitempty"` // part of lectio.score
+	IssueCollection `json:"-"`             // part of lectio.score, serialized as "issues" by MarshalJSON
+	APIError        *FacebookGraphAPIError `json:"error,omitempty"` // direct mapping to Facebook API result via Unmarshal httpRes.Body
+	ID              string                 `json:"id"`              // direct mapping to Facebook API result via Unmarshal httpRes.Body
+	Shares          *FacebookGraphShares   `json:"share"`           // direct mapping to Facebook API result via Unmarshal httpRes.Body
+	OpenGraph       *FacebookGraphOGObject `json:"og_object"`       // direct mapping to Facebook API result via Unmarshal httpRes.Body
+
+	validity ValidityPolicy // nil means DefaultValidityPolicy, serialized as "validity" if it's an IssueValidityPolicy
 }
 
 // SourceID returns the name of the scoring engine
@@ -40,12 +109,15 @@ func (fb FacebookLinkScores) TargetURL() string {
 	return fb.URL
 }
 
-// IsValid returns true if the FacebookLinkScores object is valid (did not return Facebook error object)
+// IsValid returns true if the FacebookLinkScores object is valid under the scorer's ValidityPolicy (by default no error
+// Issues, warnings such as retried attempts don't count)
 func (fb FacebookLinkScores) IsValid() bool {
-	if fb.IssuesFound == nil || len(fb.IssuesFound) == 0 {
-		return true
-	}
-	return false
+	return fb.ValidUnder(fb.validity)
+}
+
+// ValidUnder returns true if the scores are valid under the policy, e.g. to judge reloaded scores differently
+func (fb FacebookLinkScores) ValidUnder(policy ValidityPolicy) bool {
+	return validityOrDefault(policy).IsValid(&fb.IssueCollection)
 }
 
 // SharesCount is the count of how many times the given URL was shared by this scorer, -1 if invalid or not available
@@ -64,45 +136,38 @@ func (fb FacebookLinkScores) CommentsCount() int {
 	return -1
 }
 
-// Issues contains all the problems detected in scoring
-func (fb FacebookLinkScores) Issues() Issues {
-	return fb
+// Metrics returns the Facebook shares and comments, empty if invalid or not available
+func (fb FacebookLinkScores) Metrics() Metrics {
+	if !fb.IsValid() || fb.Shares == nil {
+		return nil
+	}
+	return Metrics{
+		countMetric(SharesMetric, FacebookNetwork, fb.Shares.ShareCount),
+		countMetric(CommentsMetric, FacebookNetwork, fb.Shares.CommentCount),
+	}
 }
 
-// ErrorsAndWarnings contains the problems in this link plus satisfies the Link.Issues interface
-func (fb FacebookLinkScores) ErrorsAndWarnings() []Issue {
-	return fb.IssuesFound
+// finish locates the issues at this scorer and URL and masks credentials so they're never stored or serialized
+func (fb *FacebookLinkScores) finish(redactor *Redactor) {
+	fb.APIEndpoint = redactor.Endpoint(fb.APIEndpoint)
+	fb.IssueCollection.finish(fb.MachineName, fb.URL, redactor)
 }
 
-// IssueCounts returns the total, errors, and warnings counts
-func (fb FacebookLinkScores) IssueCounts() (uint, uint, uint) {
-	if fb.IssuesFound == nil {
-		return 0, 0, 0
-	}
-	var errors, warnings uint
-	for _, i := range fb.IssuesFound {
-		if i.IsError() {
-			errors++
-		} else {
-			warnings++
-		}
-	}
-	return uint(len(fb.IssuesFound)), errors, warnings
+// MarshalJSON adds the Issues and the validity policy, if it can be serialized, to the serialized scores
+func (fb FacebookLinkScores) MarshalJSON() ([]byte, error) {
+	type plain FacebookLinkScores
+	return marshalWithIssues(plain(fb), &fb.IssueCollection, fb.validity)
 }
 
-// HandleIssues loops through each issue and calls a particular handler
-func (fb FacebookLinkScores) HandleIssues(errorHandler func(Issue), warningHandler func(Issue)) {
-	if fb.IssuesFound == nil {
-		return
-	}
-	for _, i := range fb.IssuesFound {
-		if i.IsError() && errorHandler != nil {
-			errorHandler(i)
-		}
-		if i.IsWarning() && warningHandler != nil {
-			warningHandler(i)
-		}
-	}
+// UnmarshalJSON rebuilds the concrete Issues so that stored results can be reloaded
+func (fb *FacebookLinkScores) UnmarshalJSON(data []byte) error {
+	type plain FacebookLinkScores
+	return unmarshalWithIssues(data, (*plain)(fb), &fb.IssueCollection, &fb.validity)
+}
+
+// Issues contains all the problems detected in scoring
+func (fb FacebookLinkScores) Issues() Issues {
+	return &fb.IssueCollection
 }
 
 // FacebookGraphAPIError is the type-safe version of a Facebook API Graph error (e.g. rate limiting)
@@ -110,10 +175,39 @@ type FacebookGraphAPIError struct {
 	Message   string `json:"message"`
 	Type      string `json:"type"`
 	Transient bool   `json:"is_transient"`
-	Code      string `json:"code"`
+	Code      int    `json:"code"`
+	Subcode   int    `json:"error_subcode,omitempty"`
 	TraceID   string `json:"fbtrace_id"`
 }
 
+// ProviderCode returns the Facebook error code, including the subcode if there is one (e.g. "190/460")
+func (e FacebookGraphAPIError) ProviderCode() string {
+	if e.Subcode != 0 {
+		return fmt.Sprintf("%d/%d", e.Code, e.Subcode)
+	}
+	return strconv.Itoa(e.Code)
+}
+
+// issue converts the Facebook error object into an Issue
+func (e FacebookGraphAPIError) issue(apiEndpoint string) Issue {
+	return newAPIErrorIssue(apiEndpoint, e.ProviderCode(), e.TraceID, fmt.Sprintf("Facebook Graph API returned %s error %s: %s", e.Type, e.ProviderCode(), e.Message), true, e.category())
+}
+
+// category classifies the well-known Graph API error codes
+func (e FacebookGraphAPIError) category() IssueCategory {
+	switch {
+	case e.Code == 4 || e.Code == 17 || e.Code == 32 || e.Code == 341 || e.Code == 613:
+		return QuotaIssue
+	case e.Code == 102 || e.Code == 190 || e.Code == 10 || (e.Code >= 200 && e.Code <= 299):
+		return AuthIssue
+	case e.Code == 12 || e.Code == 2635:
+		return ProviderDeprecatedIssue
+	case e.Code == 1 || e.Code == 2:
+		return NetworkIssue
+	}
+	return UncategorizedIssue
+}
+
 // FacebookGraphShares is the type-safe version of a Facebook API Graph shares object
 type FacebookGraphShares struct {
 	ShareCount   int `json:"share_count"`
@@ -130,29 +224,94 @@ type FacebookGraphOGObject struct {
 
 // GetFacebookLinkScoresForURLText takes a text URL to score and returns the Facebook graph (and share counts)
 func GetFacebookLinkScoresForURLText(url string, client *http.Client, simulateFacebookAPI bool) *FacebookLinkScores {
-	apiEndpoint := "https://graph.facebook.com/?id=" + url
+	return GetFacebookLinkScoresForURLTextWithContext(context.Background(), url, client, simulateFacebookAPI)
+}
+
+// GetFacebookLinkScoresForURLTextWithContext takes a text URL to score and returns the Facebook graph (and share counts), the API call is aborted if ctx is done
+func GetFacebookLinkScoresForURLTextWithContext(ctx context.Context, url string, client *http.Client, simulateFacebookAPI bool) *FacebookLinkScores {
+	return NewFacebookScorer(client, simulateFacebookAPI).scoreURLText(ctx, url)
+}
+
+func (s *FacebookScorer) scoreURLText(ctx context.Context, url string) *FacebookLinkScores {
+	apiEndpoint, endpointIssue := buildAPIEndpoint(s.APIBaseURL(), map[string]string{"id": url})
 	result := new(FacebookLinkScores)
-	result.MachineName = "facebook"
+	result.validity = s.Validity
+	result.MachineName = FacebookScorerMachineName
 	result.HumanName = "Facebook"
 	result.URL = url
 	result.APIEndpoint = apiEndpoint
-	if simulateFacebookAPI {
-		result.Simulated = simulateFacebookAPI
+	defer result.finish(NewRedactor(s.SensitiveParams()...))
+	if endpointIssue != nil {
+		result.Add(endpointIssue)
+		return result
+	}
+	if ctx.Err() != nil {
+		result.Add(newContextIssue(apiEndpoint, ctx.Err()))
+		return result
+	}
+	if s.Simulate {
+		result.Simulated = true
 		result.Shares = new(FacebookGraphShares)
 		result.Shares.ShareCount = rand.Intn(750)
 		result.Shares.CommentCount = rand.Intn(2500)
 		return result
 	}
-	httpRes, issue := getHTTPResult(apiEndpoint, client, HTTPUserAgent)
-	result.APIEndpoint = httpRes.apiEndpoint
+	call := newAPICall(apiEndpoint, s.Client, s.ProviderPolicies)
+	call.isTransient = isTransientFacebookGraphAPIError
+	call.cacheable = isCacheableFacebookGraphResponse
+	httpRes, issue := getHTTPResult(ctx, call)
+	result.APIAttempts = httpRes.attempts
+	result.Add(httpRes.issues...)
 	if issue != nil {
-		result.IssuesFound = append(result.IssuesFound, issue)
+		// error responses usually explain themselves better than their HTTP status does
+		if httpRes.body != nil {
+			if apiError := decodeFacebookGraphAPIError(*httpRes.body); apiError != nil {
+				result.APIError = apiError
+				issue = inheritAttemptContext(apiError.issue(apiEndpoint), issue)
+			}
+		}
+		result.Add(issue)
+		return result
+	}
+	result.APIEndpoint = httpRes.apiEndpoint
+	if issue := decodeAPIResponseBody(apiEndpoint, *httpRes.body, result); issue != nil {
+		result.Add(issue)
+		return result
+	}
+	if result.APIError != nil {
+		result.Add(result.APIError.issue(apiEndpoint))
 		return result
 	}
-	json.Unmarshal(*httpRes.body, result)
+	if len(result.ID) == 0 {
+		result.Add(NewIssue(apiEndpoint, UnexpectedAPIResponseBody, "Facebook Graph API response has neither an id nor an error", true))
+	}
 	return result
 }
 
+// decodeFacebookGraphAPIError returns the Facebook API Graph error in the body, nil if there isn't one
+func decodeFacebookGraphAPIError(body []byte) *FacebookGraphAPIError {
+	var payload struct {
+		APIError *FacebookGraphAPIError `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	return payload.APIError
+}
+
+// isTransientFacebookGraphAPIError returns true if the body contains a Facebook API Graph error which may be retried
+func isTransientFacebookGraphAPIError(body []byte) bool {
+	apiError := decodeFacebookGraphAPIError(body)
+	return apiError != nil && apiError.Transient
+}
+
+// isCacheableFacebookGraphResponse returns true if the body has an id and no Facebook API Graph error
+func isCacheableFacebookGraphResponse(body []byte) bool {
+	type plain FacebookLinkScores
+	var payload plain
+	return json.Unmarshal(body, &payload) == nil && payload.APIError == nil && len(payload.ID) > 0
+}
+
 // GetFacebookLinkScoresForURL takes a URL to score and returns the Facebook graph (and share counts)
 func GetFacebookLinkScoresForURL(url *url.URL, client *http.Client, simulateFacebookAPI bool) (*FacebookLinkScores, error) {
 	if url == nil {
@@ -160,3 +319,11 @@ func GetFacebookLinkScoresForURL(url *url.URL, client *http.Client, simulateFace
 	}
 	return GetFacebookLinkScoresForURLText(url.String(), client, simulateFacebookAPI), nil
 }
+
+// GetFacebookLinkScoresForURLWithContext takes a URL to score and returns the Facebook graph (and share counts), the API call is aborted if ctx is done
+func GetFacebookLinkScoresForURLWithContext(ctx context.Context, url *url.URL, client *http.Client, simulateFacebookAPI bool) (*FacebookLinkScores, error) {
+	if url == nil {
+		return nil, errors.New("Null URL passed to GetFacebookLinkScoresForURLWithContext")
+	}
+	return GetFacebookLinkScoresForURLTextWithContext(ctx, url.String(), client, simulateFacebookAPI), nil
+}
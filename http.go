@@ -1,9 +1,15 @@
 package score
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -13,38 +19,337 @@ const HTTPUserAgent = "github.com/lectio/score"
 // HTTPTimeout may be passed into getHTTPResult function as the default HTTP timeout parameter
 const HTTPTimeout = time.Second * 90
 
+var defaultHTTPClient = &http.Client{Timeout: HTTPTimeout}
+
+// RetryPolicy configures how failed API calls are retried with exponential backoff
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts including the first, 1 or less means no retries
+	InitialBackoff time.Duration // wait before the first retry
+	MaxBackoff     time.Duration // upper limit of any computed backoff, zero means no limit (Retry-After may exceed it)
+	Multiplier     float64       // how much the backoff grows after each retry, less than 1 is treated as 1
+	Jitter         float64       // fraction (0 to 1) of each backoff which is randomized up or down
+}
+
+// DefaultRetryPolicy is a reasonable policy for the built-in providers
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns how long to wait after the given (1-based) failed attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 {
+		delay = math.Min(delay, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		delay += delay * math.Min(p.Jitter, 1) * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// ProviderPolicies are the policies a built-in provider applies to each of its API calls
+type ProviderPolicies struct {
+	Retry *RetryPolicy // nil means each API call is only attempted once
+	Cache *CachePolicy // nil means responses aren't cached
+
+	// RateLimiter throttles every HTTP request (including retries, but not cache hits), nil means no limit
+	RateLimiter *RateLimiter
+
+	// CircuitBreaker short-circuits calls to a provider which keeps failing, nil means calls are always attempted
+	CircuitBreaker *CircuitBreaker
+
+	// Validity decides whether the provider's scores are valid, nil means DefaultValidityPolicy
+	Validity ValidityPolicy
+}
+
+// apiCall describes a provider API call and the policies which apply to it
+type apiCall struct {
+	apiEndpoint string
+	client      *http.Client
+	userAgent   string
+	retry       *RetryPolicy
+	cache       *CachePolicy
+	rateLimiter *RateLimiter
+	breaker     *CircuitBreaker
+	isTransient func(body []byte) bool // lets providers flag errors reported in the body (e.g. Facebook's is_transient) as retryable
+	cacheable   func(body []byte) bool // lets providers keep bodies they can't score (e.g. error objects) out of the cache
+
+	// sleep waits between attempts (tests replace it), nil means a timer which gives up if ctx is done
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+func newAPICall(apiEndpoint string, client *http.Client, policies ProviderPolicies) *apiCall {
+	result := new(apiCall)
+	result.apiEndpoint = apiEndpoint
+	result.client = client
+	result.userAgent = HTTPUserAgent
+	result.retry = policies.Retry
+	result.cache = policies.Cache
+	result.rateLimiter = policies.RateLimiter
+	result.breaker = policies.CircuitBreaker
+	return result
+}
+
+func (c *apiCall) cacheKey() string {
+	return c.apiEndpoint
+}
+
+// isCacheable returns true if the provider accepts the body, nil cacheable means every successful body is cached
+func (c *apiCall) isCacheable(body []byte) bool {
+	return c.cacheable == nil || c.cacheable(body)
+}
+
 // HTTPResult encapsulates an API call
 type httpResult struct {
 	apiEndpoint string
-	body        *[]byte
+	body        *[]byte // when the call failed this is the body of the last error response, if there was one
+	attempts    int     // zero when the body came from the cache
+	issues      []Issue // warnings about each failed attempt which was retried
+	transient   bool    // the body still reports a transient error after the last attempt, so it wasn't cached
 }
 
-// GetHTTPResult runs the apiEndpoint and returns the body of the HTTP result
-// TODO: Consider using [HTTP Cache](https://github.com/gregjones/httpcache)
-func getHTTPResult(apiEndpoint string, client *http.Client, userAgent string) (*httpResult, Issue) {
+// GetHTTPResult runs the API call (or serves it from its cache), retrying according to its policy, and returns the
+// body of the HTTP result; the result is never nil so the attempts can always be recorded and the call is aborted if ctx is done
+func getHTTPResult(ctx context.Context, call *apiCall) (*httpResult, Issue) {
 	result := new(httpResult)
-	result.apiEndpoint = apiEndpoint
+	result.apiEndpoint = call.apiEndpoint
 
-	req, reqErr := http.NewRequest(http.MethodGet, apiEndpoint, nil)
+	if cached, found, fresh := call.cache.lookup(call.cacheKey()); found && (fresh || call.cache.ServeStale) {
+		if !fresh {
+			call.cache.revalidate(call)
+		}
+		body := cached.Body
+		result.body = &body
+		return result, nil
+	}
+
+	permit, issue := call.breaker.allow(call.apiEndpoint)
+	if issue != nil {
+		return result, issue
+	}
+
+	maxAttempts := call.retry.maxAttempts()
+	for {
+		result.attempts++
+		attempt := executeHTTPRequest(ctx, call)
+		attempt.locate(attempt.issue, result.attempts)
+		if attempt.issue == nil && !(attempt.retryable && result.attempts < maxAttempts) {
+			result.body = &attempt.body
+			if attempt.retryable {
+				// the provider decodes the error in the body, but it's neither a success nor worth caching
+				result.transient = true
+				call.breaker.record(permit, callFailed)
+				return result, nil
+			}
+			call.breaker.record(permit, callSucceeded)
+			if call.isCacheable(attempt.body) {
+				call.cache.store(call.cacheKey(), attempt.body)
+			}
+			return result, nil
+		}
+		if !attempt.retryable || result.attempts >= maxAttempts {
+			call.breaker.record(permit, attempt.breakerOutcome())
+			if len(attempt.body) > 0 {
+				result.body = &attempt.body
+			}
+			return result, attempt.issue
+		}
+
+		delay := call.retry.backoff(result.attempts)
+		if attempt.retryAfter > delay {
+			delay = attempt.retryAfter
+		}
+		message := "API reported a transient error"
+		code := APIErrorResponseFound
+		category := UncategorizedIssue
+		var cause error
+		if attempt.issue != nil {
+			cause, _ = attempt.issue.(error)
+			message = attempt.issue.Issue()
+			code = attempt.issue.IssueCode()
+			category = IssueCategoryOf(attempt.issue)
+		}
+		warning := withCause(NewClassifiedIssue(call.apiEndpoint, code, fmt.Sprintf("Attempt %d of %d failed, retrying in %v: %s", result.attempts, maxAttempts, delay, message), WarningSeverity, category), cause)
+		result.issues = append(result.issues, attempt.locate(warning, result.attempts))
+
+		if err := call.wait(ctx, delay); err != nil {
+			issue := newContextIssue(call.apiEndpoint, err)
+			call.breaker.record(permit, httpAttempt{issue: issue}.breakerOutcome())
+			return result, issue
+		}
+	}
+}
+
+// wait sleeps before the next attempt, returning the context's error if it's done first
+func (c *apiCall) wait(ctx context.Context, delay time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, delay)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// httpAttempt is the outcome of a single HTTP request
+type httpAttempt struct {
+	body       []byte
+	issue      Issue
+	retryable  bool
+	retryAfter time.Duration
+	statusCode int           // zero if there was no response
+	latency    time.Duration // how long the request took, not counting the wait for the rate limiter
+}
+
+// locate records the attempt number, response status and latency in the issue's context
+func (a httpAttempt) locate(i Issue, number int) Issue {
+	return updateIssueContext(i, func(context *IssueContext) {
+		context.Attempt = number
+		context.HTTPStatus = a.statusCode
+		context.Latency = a.latency
+	})
+}
+
+// executeHTTPRequest waits for the rate limiter and then sends the request, only the request itself is timed
+func executeHTTPRequest(ctx context.Context, call *apiCall) httpAttempt {
+	apiEndpoint := call.apiEndpoint
+	if ctx.Err() != nil {
+		return httpAttempt{issue: newContextIssue(apiEndpoint, ctx.Err())}
+	}
+	if issue := call.rateLimiter.acquire(ctx, apiEndpoint); issue != nil {
+		return httpAttempt{issue: issue}
+	}
+	started := time.Now()
+	attempt := sendHTTPRequest(ctx, call)
+	attempt.latency = time.Since(started)
+	return attempt
+}
+
+func sendHTTPRequest(ctx context.Context, call *apiCall) httpAttempt {
+	apiEndpoint := call.apiEndpoint
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, apiEndpoint, nil)
 	if reqErr != nil {
-		return nil, NewIssue(apiEndpoint, UnableToCreateHTTPRequest, fmt.Sprintf("Unable to create HTTP request: %v", reqErr), true)
+		return httpAttempt{issue: NewIssueWithCause(apiEndpoint, UnableToCreateHTTPRequest, fmt.Sprintf("Unable to create HTTP request: %v", reqErr), true, reqErr)}
+	}
+	req.Header.Set("User-Agent", call.userAgent)
+	client := call.client
+	if client == nil {
+		client = defaultHTTPClient
 	}
-	req.Header.Set("User-Agent", userAgent)
 	resp, getErr := client.Do(req)
 	if getErr != nil {
-		return nil, NewIssue(apiEndpoint, UnableToExecuteHTTPGETRequest, fmt.Sprintf("Unable to execute HTTP GET request: %v", getErr), true)
+		if ctx.Err() != nil {
+			return httpAttempt{issue: newContextIssue(apiEndpoint, ctx.Err())}
+		}
+		return httpAttempt{issue: NewIssueWithCause(apiEndpoint, UnableToExecuteHTTPGETRequest, fmt.Sprintf("Unable to execute HTTP GET request: %v", getErr), true, getErr), retryable: true}
 	}
 	defer resp.Body.Close()
 
+	body, readErr := ioutil.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return nil, NewHTTPResponseIssue(apiEndpoint, resp.StatusCode, fmt.Sprintf("HTTP response status is not 200: %v", resp.StatusCode), true)
+		return httpAttempt{
+			statusCode: resp.StatusCode,
+			body:       body,
+			issue:      NewHTTPResponseIssue(apiEndpoint, resp.StatusCode, fmt.Sprintf("HTTP response status is not 200: %v", resp.StatusCode), true),
+			retryable:  isRetryableHTTPStatus(resp.StatusCode) || (readErr == nil && call.isTransient != nil && call.isTransient(body)),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
-
-	body, readErr := ioutil.ReadAll(resp.Body)
 	if readErr != nil {
-		return nil, NewIssue(apiEndpoint, UnableToReadBodyFromHTTPResponse, fmt.Sprintf("Unable to read body from HTTP response: %v", readErr), true)
+		if ctx.Err() != nil {
+			return httpAttempt{issue: newContextIssue(apiEndpoint, ctx.Err())}
+		}
+		return httpAttempt{issue: NewIssueWithCause(apiEndpoint, UnableToReadBodyFromHTTPResponse, fmt.Sprintf("Unable to read body from HTTP response: %v", readErr), true, readErr), retryable: true, statusCode: resp.StatusCode}
+	}
+
+	// a 200 response may still report a transient error in its body, it's retried but not an Issue by itself
+	return httpAttempt{body: body, retryable: call.isTransient != nil && call.isTransient(body), statusCode: resp.StatusCode}
+}
+
+// breakerOutcome decides whether a failed attempt says the provider is unhealthy, only network errors, transport
+// timeouts and retryable statuses do; client errors (e.g. 404) mean the provider is up, and the caller's own
+// cancellations and deadlines say nothing about it
+func (a httpAttempt) breakerOutcome() callOutcome {
+	if a.issue == nil {
+		return callSucceeded
 	}
+	switch a.issue.IssueCode() {
+	case ScoringCancelled, ScoringDeadlineExceeded, RateLimitExceeded:
+		return callIgnored
+	}
+	if a.retryable {
+		return callFailed
+	}
+	return callSucceeded
+}
+
+func isRetryableHTTPStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
 
-	result.body = &body
-	return result, nil
+// parseRetryAfter understands both forms of the Retry-After header (delay in seconds or an HTTP date)
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(when); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// buildAPIEndpoint adds the parameters to the base URL's query string, encoding them so that target URLs containing
+// &, # or their own query strings (and API keys with special characters) reach the API intact
+func buildAPIEndpoint(baseURL string, params map[string]string) (string, Issue) {
+	endpoint, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL, NewIssueWithCause(baseURL, UnableToCreateHTTPRequest, fmt.Sprintf("Unable to parse API base URL: %v", err), true, err)
+	}
+	query := endpoint.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// decodeAPIResponseBody unmarshals an API response body into target, returning an Issue if the body isn't valid for it
+func decodeAPIResponseBody(apiEndpoint string, body []byte, target interface{}) Issue {
+	if err := json.Unmarshal(body, target); err != nil {
+		return NewIssueWithCause(apiEndpoint, UnableToDecodeAPIResponseBody, fmt.Sprintf("Unable to decode API response body: %v", err), true, err)
+	}
+	return nil
+}
+
+// newContextIssue turns a context cancellation or deadline into its own Issue code
+func newContextIssue(apiEndpoint string, err error) Issue {
+	if err == context.DeadlineExceeded {
+		return NewIssueWithCause(apiEndpoint, ScoringDeadlineExceeded, fmt.Sprintf("Scoring deadline exceeded: %v", err), true, err)
+	}
+	return NewIssueWithCause(apiEndpoint, ScoringCancelled, fmt.Sprintf("Scoring was cancelled: %v", err), true, err)
 }
@@ -0,0 +1,406 @@
+package score
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// IssueCollection is a concurrency-safe list of Issues shared by all the result types, it satisfies the Issues and
+// ClassifiedIssues interfaces and remembers which provider raised each Issue it merged from another collection.
+// The zero value is ready to use and result types embed it by value; its list is allocated when issues are first added
+// (safely, even if other goroutines are using the collection) and shared from then on, so copying a result shares
+// rather than copies the issues. It has no JSON methods of
+// its own because embedding would promote them, the result types serialize it as their "issues" field.
+type IssueCollection struct {
+	list *issueList // only accessed through current and shared, which load and store it atomically
+}
+
+type issueList struct {
+	mutex     sync.RWMutex
+	issues    []Issue
+	providers []string // the provider machine name of each issue, empty when the collection's owner raised it
+	merged    []bool   // true for each issue merged from a child collection, the child is responsible for serializing it
+}
+
+// NewIssueCollection creates a collection holding the issues
+func NewIssueCollection(issues ...Issue) *IssueCollection {
+	result := new(IssueCollection)
+	result.Add(issues...)
+	return result
+}
+
+func (c *IssueCollection) listPointer() *unsafe.Pointer {
+	return (*unsafe.Pointer)(unsafe.Pointer(&c.list))
+}
+
+// current returns the collection's list, nil if nothing has been added to a zero value collection yet
+func (c *IssueCollection) current() *issueList {
+	if c == nil {
+		return nil
+	}
+	return (*issueList)(atomic.LoadPointer(c.listPointer()))
+}
+
+// shared returns the collection's list, allocating it if nothing has been added to a zero value collection yet
+func (c *IssueCollection) shared() *issueList {
+	if list := c.current(); list != nil {
+		return list
+	}
+	atomic.CompareAndSwapPointer(c.listPointer(), nil, unsafe.Pointer(new(issueList)))
+	return c.current()
+}
+
+// Add appends issues raised by the collection's owner, nil issues are skipped
+func (c *IssueCollection) Add(issues ...Issue) {
+	c.AddFromProvider("", issues...)
+}
+
+// AddFromProvider appends issues raised by the provider with the machine name
+func (c *IssueCollection) AddFromProvider(provider string, issues ...Issue) {
+	c.add(provider, false, issues...)
+}
+
+func (c *IssueCollection) add(provider string, merged bool, issues ...Issue) {
+	list := c.shared()
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	for _, i := range issues {
+		if i != nil {
+			list.issues = append(list.issues, i)
+			list.providers = append(list.providers, provider)
+			list.merged = append(list.merged, merged)
+		}
+	}
+}
+
+// IssuesFound returns a copy of the issues.
+//
+// Deprecated: IssuesFound used to be an exported field of each result type, use ErrorsAndWarnings instead.
+func (c *IssueCollection) IssuesFound() []Issue {
+	return c.ErrorsAndWarnings()
+}
+
+// Merge appends a child's issues, attributing them to the provider unless the child already knows who raised them
+func (c *IssueCollection) Merge(provider string, child Issues) {
+	if child == nil {
+		return
+	}
+	collection, ok := child.(*IssueCollection)
+	if !ok {
+		c.add(provider, true, child.ErrorsAndWarnings()...)
+		return
+	}
+	list := c.shared()
+	if collection.current() == list {
+		return
+	}
+	issues, providers := collection.snapshot()
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	for index, i := range issues {
+		if len(providers[index]) == 0 {
+			providers[index] = provider
+		}
+		list.issues = append(list.issues, i)
+		list.providers = append(list.providers, providers[index])
+		list.merged = append(list.merged, true)
+	}
+}
+
+func (c *IssueCollection) snapshot() ([]Issue, []string) {
+	list := c.current()
+	if list == nil {
+		return nil, nil
+	}
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	return append([]Issue(nil), list.issues...), append([]string(nil), list.providers...)
+}
+
+// own returns a collection of the issues which weren't merged from a child collection
+func (c *IssueCollection) own() *IssueCollection {
+	result := new(IssueCollection)
+	list := c.current()
+	if list == nil {
+		return result
+	}
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	for index, i := range list.issues {
+		if !list.merged[index] {
+			result.AddFromProvider(list.providers[index], i)
+		}
+	}
+	return result
+}
+
+// Len returns how many issues are in the collection
+func (c *IssueCollection) Len() int {
+	list := c.current()
+	if list == nil {
+		return 0
+	}
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	return len(list.issues)
+}
+
+// HasErrors returns true if any of the issues is an error rather than a warning
+func (c *IssueCollection) HasErrors() bool {
+	issues, _ := c.snapshot()
+	return hasErrors(issues)
+}
+
+// ErrorsAndWarnings returns a copy of the issues and satisfies the Issues interface
+func (c *IssueCollection) ErrorsAndWarnings() []Issue {
+	issues, _ := c.snapshot()
+	return issues
+}
+
+// IssueCounts returns the total, errors, and warnings counts
+func (c *IssueCollection) IssueCounts() (uint, uint, uint) {
+	issues, _ := c.snapshot()
+	var errors, warnings uint
+	for _, i := range issues {
+		if i.IsError() {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	return uint(len(issues)), errors, warnings
+}
+
+// HandleIssues loops through each issue and calls a particular handler
+func (c *IssueCollection) HandleIssues(errorHandler func(Issue), warningHandler func(Issue)) {
+	issues, _ := c.snapshot()
+	for _, i := range issues {
+		if i.IsError() && errorHandler != nil {
+			errorHandler(i)
+		}
+		if i.IsWarning() && warningHandler != nil {
+			warningHandler(i)
+		}
+	}
+}
+
+// FilterIssues returns the issues at or above minSeverity in any of the categories (all categories if none are given)
+func (c *IssueCollection) FilterIssues(minSeverity IssueSeverity, categories ...IssueCategory) []Issue {
+	issues, _ := c.snapshot()
+	return FilterIssues(issues, minSeverity, categories...)
+}
+
+// IssueCountsBySeverity returns how many issues there are at each severity
+func (c *IssueCollection) IssueCountsBySeverity() map[IssueSeverity]uint {
+	issues, _ := c.snapshot()
+	return CountIssuesBySeverity(issues)
+}
+
+// IssueCountsByCategory returns how many issues there are in each category
+func (c *IssueCollection) IssueCountsByCategory() map[IssueCategory]uint {
+	issues, _ := c.snapshot()
+	return CountIssuesByCategory(issues)
+}
+
+// HandleIssuesBySeverity loops through each issue and calls the handler for its severity, if there is one
+func (c *IssueCollection) HandleIssuesBySeverity(handlers map[IssueSeverity]func(Issue)) {
+	issues, _ := c.snapshot()
+	HandleIssuesBySeverity(issues, handlers)
+}
+
+// Filter returns the issues for which keep returns true, provider is empty for the owner's own issues
+func (c *IssueCollection) Filter(keep func(i Issue, provider string) bool) []Issue {
+	issues, providers := c.snapshot()
+	var result []Issue
+	for index, i := range issues {
+		if keep(i, providers[index]) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// WithCode returns the issues with the code, or a code derived from it such as an HTTP status code
+func (c *IssueCollection) WithCode(code string) []Issue {
+	return c.Filter(func(i Issue, provider string) bool {
+		return i.IssueCode() == code || IsIssueCode(asError(i), code)
+	})
+}
+
+// FromProvider returns the issues raised by the provider with the machine name
+func (c *IssueCollection) FromProvider(provider string) []Issue {
+	return c.Filter(func(i Issue, p string) bool { return p == provider })
+}
+
+// ProviderOf returns the machine name of the provider which raised the issue, empty if it wasn't merged from a provider
+func (c *IssueCollection) ProviderOf(i Issue) string {
+	issues, providers := c.snapshot()
+	for index, candidate := range issues {
+		if candidate == i {
+			return providers[index]
+		}
+	}
+	return ""
+}
+
+// Deduplicated returns the issues without repeats, an issue repeats another if it has the same provider, code,
+// severity, message and location (when it occurred and on which attempt don't matter), only the first of them is kept
+func (c *IssueCollection) Deduplicated() []Issue {
+	issues, providers := c.snapshot()
+	seen := make(map[string]bool)
+	var result []Issue
+	for index, i := range issues {
+		key := fmt.Sprintf("%s\x00%s\x00%v\x00%s\x00%s", providers[index], i.IssueCode(), IssueSeverityOf(i), i.Issue(), locationKey(i))
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// GroupByCode returns the issues keyed by their code
+func (c *IssueCollection) GroupByCode() map[string][]Issue {
+	issues, _ := c.snapshot()
+	result := make(map[string][]Issue)
+	for _, i := range issues {
+		result[i.IssueCode()] = append(result[i.IssueCode()], i)
+	}
+	return result
+}
+
+// finish replaces each issue with its redacted copy, filling in the provider and target URL where they're missing; the
+// copy is made first so issues shared with other collections (or still held by the caller) aren't changed
+func (c *IssueCollection) finish(provider string, targetURL string, redactor *Redactor) {
+	list := c.shared()
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	for index, i := range list.issues {
+		list.issues[index] = updateIssueContext(redactor.Issue(i), func(context *IssueContext) {
+			if len(context.Provider) == 0 {
+				context.Provider = provider
+			}
+			if len(context.TargetURL) == 0 {
+				context.TargetURL = redactor.Endpoint(targetURL)
+			}
+		})
+	}
+}
+
+// marshalJSON serializes the issues as an array, issues merged from a provider get a "provider" key
+func (c *IssueCollection) marshalJSON() ([]byte, error) {
+	issues, providers := c.snapshot()
+	result := make([]json.RawMessage, 0, len(issues))
+	for index, i := range issues {
+		data, err := json.Marshal(i)
+		if err != nil {
+			return nil, err
+		}
+		if len(providers[index]) > 0 {
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(data, &fields) == nil {
+				fields["provider"], _ = json.Marshal(providers[index])
+				if data, err = json.Marshal(fields); err != nil {
+					return nil, err
+				}
+			}
+		}
+		result = append(result, data)
+	}
+	return json.Marshal(result)
+}
+
+// unmarshalJSON rebuilds the concrete Issues and which provider raised each of them
+func (c *IssueCollection) unmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var issues []Issue
+	var providers []string
+	var merged []bool
+	for _, element := range raw {
+		i, err := UnmarshalIssue(element)
+		if err != nil {
+			return err
+		}
+		var attribution struct {
+			Provider string `json:"provider"`
+		}
+		json.Unmarshal(element, &attribution)
+		issues = append(issues, i)
+		providers = append(providers, attribution.Provider)
+		merged = append(merged, false)
+	}
+	list := c.shared()
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	list.issues = issues
+	list.providers = providers
+	list.merged = merged
+	return nil
+}
+
+// marshalWithIssues serializes a result (converted to a type without the result's JSON methods) and adds the
+// collection as its "issues" field, plus its validity policy as a "validity" field if it's an IssueValidityPolicy
+func marshalWithIssues(result interface{}, c *IssueCollection, validity ValidityPolicy) ([]byte, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	issues, err := c.marshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	fields := append([]byte(`"issues":`), issues...)
+	if policy, ok := serializableValidity(validity); ok {
+		serialized, err := json.Marshal(policy)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(append(fields, `,"validity":`...), serialized...)
+	}
+	separator := ","
+	if len(data) == 2 {
+		separator = ""
+	}
+	return append(append(data[:len(data)-1], separator...), append(fields, '}')...), nil
+}
+
+// unmarshalWithIssues deserializes a result (converted to a type without the result's JSON methods) and replaces its
+// collection if the data has an "issues" field, so decoding an API response body into a result keeps what it found;
+// its validity policy is likewise only replaced if the data has a "validity" field
+func unmarshalWithIssues(data []byte, result interface{}, c *IssueCollection, validity *ValidityPolicy) error {
+	if err := json.Unmarshal(data, result); err != nil {
+		return err
+	}
+	var aux struct {
+		Issues   json.RawMessage      `json:"issues"`
+		Validity *IssueValidityPolicy `json:"validity"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Validity != nil {
+		*validity = *aux.Validity
+	}
+	if len(aux.Issues) == 0 || string(aux.Issues) == "null" {
+		return nil
+	}
+	collection := new(IssueCollection)
+	if err := collection.unmarshalJSON(aux.Issues); err != nil {
+		return err
+	}
+	atomic.StorePointer(c.listPointer(), unsafe.Pointer(collection.current()))
+	return nil
+}
+
+func asError(i Issue) error {
+	if err, ok := i.(error); ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package score
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IssueContext locates an Issue: which provider call, for which URL, caused it and when
+type IssueContext struct {
+	Provider    string        `json:"provider,omitempty"`    // machine name of the scorer which raised the Issue
+	TargetURL   string        `json:"url,omitempty"`         // the URL being scored
+	APIEndpoint string        `json:"apiEndpoint,omitempty"` // the provider API call, with credentials redacted
+	Attempt     int           `json:"attempt,omitempty"`     // which attempt of the API call, counting from 1
+	HTTPStatus  int           `json:"httpStatus,omitempty"`  // the response status, zero if there was no response
+	Latency     time.Duration `json:"latency,omitempty"`     // how long the attempt took
+	OccurredAt  time.Time     `json:"occurredAt"`
+}
+
+// newIssueContext creates the context of an Issue occurring now at the API endpoint
+func newIssueContext(apiEndpoint string) IssueContext {
+	return IssueContext{APIEndpoint: apiEndpoint, OccurredAt: time.Now().UTC()}
+}
+
+// NewIssueWithContext creates an Issue located by the context, a zero OccurredAt means now
+func NewIssueWithContext(context IssueContext, code string, message string, isError bool, cause error) Issue {
+	result := NewIssueWithCause(context.APIEndpoint, code, message, isError, cause).(*issue)
+	if context.OccurredAt.IsZero() {
+		context.OccurredAt = result.Context.OccurredAt
+	}
+	result.Context = context
+	return result
+}
+
+// updateIssueContext changes the context of Issues created by this package
+func updateIssueContext(i Issue, update func(*IssueContext)) Issue {
+	if concrete, ok := i.(*issue); ok {
+		update(&concrete.Context)
+	}
+	return i
+}
+
+// inheritAttemptContext copies the attempt, HTTP status and latency of the Issue it replaces, e.g. when a provider's
+// error object explains a failed call better than its HTTP status did
+func inheritAttemptContext(i Issue, replaced Issue) Issue {
+	from, ok := replaced.IssueContext().(IssueContext)
+	if !ok {
+		return i
+	}
+	return updateIssueContext(i, func(context *IssueContext) {
+		context.Attempt = from.Attempt
+		context.HTTPStatus = from.HTTPStatus
+		context.Latency = from.Latency
+	})
+}
+
+// String describes where the Issue occurred, e.g. "facebook https://www.lectio.com/ (attempt 2, HTTP 503, 1.2s)"
+func (c IssueContext) String() string {
+	var parts, details []string
+	if len(c.Provider) > 0 {
+		parts = append(parts, c.Provider)
+	}
+	if len(c.TargetURL) > 0 {
+		parts = append(parts, c.TargetURL)
+	} else if len(c.APIEndpoint) > 0 {
+		parts = append(parts, c.APIEndpoint)
+	}
+	if c.Attempt > 0 {
+		details = append(details, fmt.Sprintf("attempt %d", c.Attempt))
+	}
+	if c.HTTPStatus > 0 {
+		details = append(details, fmt.Sprintf("HTTP %d", c.HTTPStatus))
+	}
+	if c.Latency > 0 {
+		details = append(details, c.Latency.String())
+	}
+	if len(details) > 0 {
+		parts = append(parts, "("+strings.Join(details, ", ")+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// UnmarshalJSON also accepts the plain API endpoint string Issues were serialized with before contexts were structured
+func (c *IssueContext) UnmarshalJSON(data []byte) error {
+	var apiEndpoint string
+	if json.Unmarshal(data, &apiEndpoint) == nil {
+		*c = IssueContext{APIEndpoint: apiEndpoint}
+		return nil
+	}
+	type plain IssueContext
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// locationKey identifies where an Issue occurred, ignoring when and on which attempt, so repeats can be detected
+func locationKey(i Issue) string {
+	if context, ok := i.IssueContext().(IssueContext); ok {
+		return fmt.Sprintf("%s\x00%s\x00%s\x00%d", context.Provider, context.TargetURL, context.APIEndpoint, context.HTTPStatus)
+	}
+	return fmt.Sprint(i.IssueContext())
+}
@@ -1,6 +1,10 @@
 package score
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 const (
 	UnableToCreateHTTPRequest        string = "SCORE_E-0100"
@@ -10,11 +14,166 @@ const (
 	APIErrorResponseFound            string = "SCORE_E-0500"
 	NoAPIKeyProvidedInCodeOrEnv      string = "SCORE_E-0600"
 	SecretManagementError            string = "SCORE_E-0700"
+	NoURLProvidedToScorer            string = "SCORE_E-0800"
+	ScoringCancelled                 string = "SCORE_E-0900"
+	ScoringDeadlineExceeded          string = "SCORE_E-1000"
+	ScorerPanicked                   string = "SCORE_E-1100"
+	RateLimitExceeded                string = "SCORE_E-1200"
+	ProviderUnavailable              string = "SCORE_E-1300"
+	UnableToDecodeAPIResponseBody    string = "SCORE_E-1400"
+	UnexpectedAPIResponseBody        string = "SCORE_E-1500"
+)
+
+// IssueCodeError lets errors.Is match Issues by code, e.g. errors.Is(err, IssueCodeError(RateLimitExceeded)), a code
+// also matches the codes derived from it such as InvalidAPIRespHTTPStatusCode's per-status codes
+type IssueCodeError string
+
+// Error satisfies the Go error contract
+func (c IssueCodeError) Error() string {
+	return string(c)
+}
+
+// IsIssueCode returns true if err is, or wraps, an Issue with the code (or a code derived from it)
+func IsIssueCode(err error, code string) bool {
+	return errors.Is(err, IssueCodeError(code))
+}
+
+// IssueSeverity ranks how serious an Issue is, the zero value means the Issue didn't say
+type IssueSeverity int
+
+const (
+	InfoSeverity    IssueSeverity = iota + 1 // worth knowing, e.g. a stale cached response was served
+	WarningSeverity                          // the result is usable, e.g. an attempt was retried
+	ErrorSeverity                            // the result is not usable
+	FatalSeverity                            // nothing will work until the configuration is fixed, e.g. a missing API key
 )
 
+var issueSeverityNames = map[IssueSeverity]string{InfoSeverity: "info", WarningSeverity: "warning", ErrorSeverity: "error", FatalSeverity: "fatal"}
+
+// String returns the lowercase name of the severity
+func (s IssueSeverity) String() string {
+	if name, ok := issueSeverityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalText serializes the severity by name
+func (s IssueSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses a severity name
+func (s *IssueSeverity) UnmarshalText(text []byte) error {
+	for severity, name := range issueSeverityNames {
+		if strings.EqualFold(name, string(text)) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown Issue severity %q", text)
+}
+
+// IssueCategory groups Issues by what went wrong
+type IssueCategory string
+
+const (
+	UncategorizedIssue      IssueCategory = ""
+	NetworkIssue            IssueCategory = "network"             // the provider couldn't be reached or didn't respond in time
+	AuthIssue               IssueCategory = "auth"                // credentials are missing, invalid or lack permission
+	QuotaIssue              IssueCategory = "quota"               // a rate limit or usage quota was hit
+	DecodeIssue             IssueCategory = "decode"              // the provider's response couldn't be understood
+	ProviderDeprecatedIssue IssueCategory = "provider-deprecated" // the provider's API or API version is gone or going away
+)
+
+// ClassifiedIssue is satisfied by Issues which carry a severity and category, use IssueSeverityOf and
+// IssueCategoryOf to classify any Issue
+type ClassifiedIssue interface {
+	Severity() IssueSeverity
+	Category() IssueCategory
+}
+
+// ClassifiedIssues is satisfied by Issues containers which can filter, count and handle Issues by severity and category
+type ClassifiedIssues interface {
+	FilterIssues(minSeverity IssueSeverity, categories ...IssueCategory) []Issue
+	IssueCountsBySeverity() map[IssueSeverity]uint
+	IssueCountsByCategory() map[IssueCategory]uint
+	HandleIssuesBySeverity(handlers map[IssueSeverity]func(Issue))
+}
+
+// IssueSeverityOf returns the Issue's severity, Issues which aren't classified are errors or warnings
+func IssueSeverityOf(i Issue) IssueSeverity {
+	if classified, ok := i.(ClassifiedIssue); ok && classified.Severity() > 0 {
+		return classified.Severity()
+	}
+	if i.IsError() {
+		return ErrorSeverity
+	}
+	return WarningSeverity
+}
+
+// IssueCategoryOf returns the Issue's category, UncategorizedIssue if it isn't classified
+func IssueCategoryOf(i Issue) IssueCategory {
+	if classified, ok := i.(ClassifiedIssue); ok {
+		return classified.Category()
+	}
+	return UncategorizedIssue
+}
+
+// FilterIssues returns the issues at or above minSeverity which are in one of the categories (any category if none are given)
+func FilterIssues(issues []Issue, minSeverity IssueSeverity, categories ...IssueCategory) []Issue {
+	var result []Issue
+	for _, i := range issues {
+		if IssueSeverityOf(i) < minSeverity {
+			continue
+		}
+		if len(categories) > 0 && !hasIssueCategory(categories, IssueCategoryOf(i)) {
+			continue
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+func hasIssueCategory(categories []IssueCategory, category IssueCategory) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// CountIssuesBySeverity returns how many of the issues there are at each severity
+func CountIssuesBySeverity(issues []Issue) map[IssueSeverity]uint {
+	result := make(map[IssueSeverity]uint)
+	for _, i := range issues {
+		result[IssueSeverityOf(i)]++
+	}
+	return result
+}
+
+// CountIssuesByCategory returns how many of the issues there are in each category
+func CountIssuesByCategory(issues []Issue) map[IssueCategory]uint {
+	result := make(map[IssueCategory]uint)
+	for _, i := range issues {
+		result[IssueCategoryOf(i)]++
+	}
+	return result
+}
+
+// HandleIssuesBySeverity calls the handler registered for each issue's severity, issues without a handler are skipped
+func HandleIssuesBySeverity(issues []Issue, handlers map[IssueSeverity]func(Issue)) {
+	for _, i := range issues {
+		if handler := handlers[IssueSeverityOf(i)]; handler != nil {
+			handler(i)
+		}
+	}
+}
+
 // Issue is a structured problem identification with context information
 type Issue interface {
-	IssueContext() interface{} // this will be the scores object plus location (item index, etc.), it's kept generic so it doesn't require package dependency
+	IssueContext() interface{} // the package's Issues return an IssueContext, it's kept generic so other Issues can locate themselves their own way
 	IssueCode() string         // useful to uniquely identify a particular code
 	Issue() string             // the
 
@@ -29,33 +188,127 @@ type Issues interface {
 	HandleIssues(errorHandler func(Issue), warningHandler func(Issue))
 }
 
+// ProviderError is satisfied by Issues created from an error object returned by a provider's API
+type ProviderError interface {
+	ProviderCode() string    // the provider's own error code (e.g. Facebook's code or SharedCount's Type)
+	ProviderTraceID() string // the provider's request trace ID (e.g. Facebook's fbtrace_id), if any
+}
+
+// hasErrors returns true if any of the issues is an error rather than a warning
+func hasErrors(issues []Issue) bool {
+	for _, i := range issues {
+		if i.IsError() {
+			return true
+		}
+	}
+	return false
+}
+
 type issue struct {
-	APIEndpoint    string `json:"context"`
-	Code           string `json:"code"`
-	Message        string `json:"message"`
-	IsIssueAnError bool   `json:"isError"`
+	Context        IssueContext  `json:"context"`
+	Code           string        `json:"code"`
+	Message        string        `json:"message"`
+	IsIssueAnError bool          `json:"isError"`
+	APIErrorCode   string        `json:"providerCode,omitempty"`
+	APITraceID     string        `json:"providerTraceId,omitempty"`
+	IssueSeverity  IssueSeverity `json:"severity,omitempty"`
+	IssueCategory  IssueCategory `json:"category,omitempty"`
+
+	cause error // the underlying Go error, it's not serialized but its message is usually part of Message
+}
+
+func severityFor(code string, isError bool) IssueSeverity {
+	if !isError {
+		return WarningSeverity
+	}
+	if info, ok := LookupIssueCode(code); ok && info.Severity > ErrorSeverity {
+		return info.Severity
+	}
+	return ErrorSeverity
+}
+
+func httpStatusCategory(httpRespStatusCode int) IssueCategory {
+	switch {
+	case httpRespStatusCode == 401 || httpRespStatusCode == 403:
+		return AuthIssue
+	case httpRespStatusCode == 429:
+		return QuotaIssue
+	case httpRespStatusCode == 410:
+		return ProviderDeprecatedIssue
+	case httpRespStatusCode == 408 || httpRespStatusCode >= 500:
+		return NetworkIssue
+	}
+	return UncategorizedIssue
 }
 
 func NewIssue(apiEndpoint string, code string, message string, isError bool) Issue {
 	result := new(issue)
-	result.APIEndpoint = apiEndpoint
+	result.Context = newIssueContext(apiEndpoint)
 	result.Code = code
 	result.Message = message
 	result.IsIssueAnError = isError
+	result.IssueSeverity = severityFor(code, isError)
+	result.IssueCategory = categoryFor(code)
+	return result
+}
+
+// NewIssueWithCause creates an Issue which wraps the underlying error so that errors.Is and errors.As can inspect it
+func NewIssueWithCause(apiEndpoint string, code string, message string, isError bool, cause error) Issue {
+	return withCause(NewIssue(apiEndpoint, code, message, isError), cause)
+}
+
+// withCause sets the underlying error of Issues created by this package
+func withCause(i Issue, cause error) Issue {
+	if concrete, ok := i.(*issue); ok {
+		concrete.cause = cause
+	}
+	return i
+}
+
+// NewClassifiedIssue creates an Issue with an explicit severity and category, IsError is true for ErrorSeverity and worse
+func NewClassifiedIssue(apiEndpoint string, code string, message string, severity IssueSeverity, category IssueCategory) Issue {
+	result := new(issue)
+	result.Context = newIssueContext(apiEndpoint)
+	result.Code = code
+	result.Message = message
+	result.IsIssueAnError = severity >= ErrorSeverity
+	result.IssueSeverity = severity
+	result.IssueCategory = category
 	return result
 }
 
 func NewHTTPResponseIssue(apiEndpoint string, httpRespStatusCode int, message string, isError bool) Issue {
 	result := new(issue)
-	result.APIEndpoint = apiEndpoint
+	result.Context = newIssueContext(apiEndpoint)
 	result.Code = fmt.Sprintf("%s-HTTP-%d", InvalidAPIRespHTTPStatusCode, httpRespStatusCode)
 	result.Message = message
 	result.IsIssueAnError = isError
+	result.IssueSeverity = severityFor(result.Code, isError)
+	result.IssueCategory = httpStatusCategory(httpRespStatusCode)
 	return result
 }
 
+// NewAPIErrorIssue creates an Issue from an error object returned by a provider's API, keeping the provider's own code and trace ID
+func NewAPIErrorIssue(apiEndpoint string, providerCode string, providerTraceID string, message string, isError bool) Issue {
+	return newAPIErrorIssue(apiEndpoint, providerCode, providerTraceID, message, isError, UncategorizedIssue)
+}
+
+func newAPIErrorIssue(apiEndpoint string, providerCode string, providerTraceID string, message string, isError bool, category IssueCategory) *issue {
+	result := new(issue)
+	result.Context = newIssueContext(apiEndpoint)
+	result.Code = APIErrorResponseFound
+	result.Message = message
+	result.IsIssueAnError = isError
+	result.APIErrorCode = providerCode
+	result.APITraceID = providerTraceID
+	result.IssueSeverity = severityFor(APIErrorResponseFound, isError)
+	result.IssueCategory = category
+	return result
+}
+
+// IssueContext returns the Issue's IssueContext
 func (i issue) IssueContext() interface{} {
-	return i.APIEndpoint
+	return i.Context
 }
 
 func (i issue) IssueCode() string {
@@ -67,14 +320,55 @@ func (i issue) Issue() string {
 }
 
 func (i issue) IsError() bool {
-	return i.IsIssueAnError
+	return i.Severity() >= ErrorSeverity
 }
 
+// IsWarning is true for anything less than an error, including info Issues, so it's always the opposite of IsError
 func (i issue) IsWarning() bool {
-	return !i.IsIssueAnError
+	return !i.IsError()
+}
+
+// Severity satisfies the ClassifiedIssue interface, Issues serialized before severities existed fall back to isError
+func (i issue) Severity() IssueSeverity {
+	if i.IssueSeverity > 0 {
+		return i.IssueSeverity
+	}
+	if i.IsIssueAnError {
+		return ErrorSeverity
+	}
+	return WarningSeverity
+}
+
+// Category satisfies the ClassifiedIssue interface
+func (i issue) Category() IssueCategory {
+	return i.IssueCategory
+}
+
+// ProviderCode satisfies the ProviderError interface
+func (i issue) ProviderCode() string {
+	return i.APIErrorCode
+}
+
+// ProviderTraceID satisfies the ProviderError interface
+func (i issue) ProviderTraceID() string {
+	return i.APITraceID
 }
 
 // Error satisfies the Go error contract
 func (i issue) Error() string {
 	return i.Message
 }
+
+// Unwrap returns the underlying Go error, nil if the Issue wasn't caused by one
+func (i issue) Unwrap() error {
+	return i.cause
+}
+
+// Is lets errors.Is match the Issue against an IssueCodeError
+func (i issue) Is(target error) bool {
+	code, ok := target.(IssueCodeError)
+	if !ok {
+		return false
+	}
+	return i.Code == string(code) || strings.HasPrefix(i.Code, string(code)+"-")
+}
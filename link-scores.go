@@ -1,6 +1,7 @@
 package score
 
 import (
+	"context"
 	"io"
 	"net/url"
 )
@@ -13,6 +14,7 @@ type LinkScores interface {
 	IsValid() bool
 	SharesCount() int
 	CommentsCount() int
+	Metrics() Metrics
 }
 
 // Lifecycle defines common creation / destruction methods
@@ -20,6 +22,11 @@ type Lifecycle interface {
 	ScoreLink(*url.URL) (LinkScores, Issue)
 }
 
+// ContextLifecycle defines creation methods which may be cancelled or given a deadline
+type ContextLifecycle interface {
+	ScoreLinkWithContext(context.Context, *url.URL) (LinkScores, Issue)
+}
+
 // Reader defines common reader methods
 type Reader interface {
 	GetLinkScores(*url.URL) (LinkScores, Issue)
@@ -1,6 +1,7 @@
 package score
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"math/rand"
@@ -14,15 +15,81 @@ const SimulateLinkedInAPI = true
 // UseLinkedInAPI is passed into GetLinkedInShareCountForURL* if we don't want to simulate the API, but actually run it
 const UseLinkedInAPI = false
 
+// DefaultLinkedInAPIBaseURL is the LinkedIn share count endpoint used when the scorer has no BaseURL
+const DefaultLinkedInAPIBaseURL = "https://www.linkedin.com/countserv/count/share"
+
+// LinkedInScorerMachineName is the machine name the LinkedIn scorer registers under
+const LinkedInScorerMachineName = "linkedin"
+
+func init() {
+	DefaultRegistry.Register(NewLinkedInScorer(nil, UseLinkedInAPI))
+	RegisterLinkScoresType(LinkedInScorerMachineName, func() LinkScores { return new(LinkedInLinkScores) })
+}
+
+// LinkedInScorer scores links using LinkedIn's share count API and satisfies the Scorer interface
+type LinkedInScorer struct {
+	Client   *http.Client
+	Simulate bool
+	BaseURL  string // empty means DefaultLinkedInAPIBaseURL, set it to use a test server, proxy or mirror
+	ProviderPolicies
+}
+
+// NewLinkedInScorer creates a LinkedIn scorer, a nil client means the package default HTTP client
+func NewLinkedInScorer(client *http.Client, simulateLinkedInAPI bool) *LinkedInScorer {
+	result := new(LinkedInScorer)
+	result.Client = client
+	result.Simulate = simulateLinkedInAPI
+	return result
+}
+
+// MachineName returns the name the scorer is registered under
+func (s *LinkedInScorer) MachineName() string {
+	return LinkedInScorerMachineName
+}
+
+// HumanName returns the display name of the scorer
+func (s *LinkedInScorer) HumanName() string {
+	return "LinkedIn"
+}
+
+// SensitiveParams satisfies the SensitiveParameters interface, LinkedIn's count API doesn't need credentials
+func (s *LinkedInScorer) SensitiveParams() []string {
+	return nil
+}
+
+// APIBaseURL returns the base URL the scorer's API calls are made to
+func (s *LinkedInScorer) APIBaseURL() string {
+	if len(s.BaseURL) > 0 {
+		return s.BaseURL
+	}
+	return DefaultLinkedInAPIBaseURL
+}
+
+// ScoreLink satisfies the Lifecycle interface
+func (s *LinkedInScorer) ScoreLink(url *url.URL) (LinkScores, Issue) {
+	return s.ScoreLinkWithContext(context.Background(), url)
+}
+
+// ScoreLinkWithContext satisfies the ContextLifecycle interface
+func (s *LinkedInScorer) ScoreLinkWithContext(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+	if url == nil {
+		return nil, NewIssueWithContext(IssueContext{Provider: s.MachineName()}, NoURLProvidedToScorer, "Null URL passed to LinkedInScorer.ScoreLink", true, nil)
+	}
+	return s.scoreURLText(ctx, url.String()), nil
+}
+
 // LinkedInLinkScores is the type-safe version of what LinkedIn's share count API returns
 type LinkedInLinkScores struct {
-	MachineName string  `json:"scorer"`
-	HumanName   string  `json:"scorerName"`
-	Simulated   bool    `json:"isSimulated,omitempty"` // part of lectio.score, omitted if it's false
-	URL         string  `json:"url"`                   // part of lectio.score
-	APIEndpoint string  `json:"apiEndPoint"`           // part of lectio.score
-	IssuesFound []Issue `json:"issues"`                // part of lectio.score
-	Count       int     `json:"count"`                 // direct mapping to LinkedIn API result via Unmarshal httpRes.Body
+	MachineName     string     `json:"scorer"`
+	HumanName       string     `json:"scorerName"`
+	Simulated       bool       `json:"isSimulated,omitempty"` // part of lectio.score, omitted if it's false
+	URL             string     `json:"url"`                   // part of lectio.score
+	APIEndpoint     string     `json:"apiEndPoint"`           // part of lectio.score
+	APIAttempts     int        `json:"apiAttempts,omitempty"` // part of lectio.score
+	IssueCollection `json:"-"` // part of lectio.score, serialized as "issues" by MarshalJSON
+	Count           int        `json:"count"` // direct mapping to LinkedIn API result via Unmarshal httpRes.Body
+
+	validity ValidityPolicy // nil means DefaultValidityPolicy, serialized as "validity" if it's an IssueValidityPolicy
 }
 
 // SourceID returns the name of the scoring engine
@@ -35,12 +102,15 @@ func (li LinkedInLinkScores) TargetURL() string {
 	return li.URL
 }
 
-// IsValid returns true if the LinkedInLinkScores object is valid (did not return LinkedIn error object)
+// IsValid returns true if the LinkedInLinkScores object is valid under the scorer's ValidityPolicy (by default no error
+// Issues, warnings such as retried attempts don't count)
 func (li LinkedInLinkScores) IsValid() bool {
-	if li.IssuesFound == nil || len(li.IssuesFound) == 0 {
-		return true
-	}
-	return false
+	return li.ValidUnder(li.validity)
+}
+
+// ValidUnder returns true if the scores are valid under the policy, e.g. to judge reloaded scores differently
+func (li LinkedInLinkScores) ValidUnder(policy ValidityPolicy) bool {
+	return validityOrDefault(policy).IsValid(&li.IssueCollection)
 }
 
 // SharesCount is the count of how many times the given URL was shared by this scorer, -1 if invalid or not available
@@ -56,70 +126,103 @@ func (li LinkedInLinkScores) CommentsCount() int {
 	return -1
 }
 
-// Issues contains all the problems detected in scoring
-func (li LinkedInLinkScores) Issues() Issues {
-	return li
+// Metrics returns the LinkedIn shares, empty if invalid
+func (li LinkedInLinkScores) Metrics() Metrics {
+	if !li.IsValid() {
+		return nil
+	}
+	return Metrics{countMetric(SharesMetric, LinkedInNetwork, li.Count)}
 }
 
-// ErrorsAndWarnings contains the problems in this link plus satisfies the Link.Issues interface
-func (li LinkedInLinkScores) ErrorsAndWarnings() []Issue {
-	return li.IssuesFound
+// finish locates the issues at this scorer and URL and masks credentials so they're never stored or serialized
+func (li *LinkedInLinkScores) finish(redactor *Redactor) {
+	li.APIEndpoint = redactor.Endpoint(li.APIEndpoint)
+	li.IssueCollection.finish(li.MachineName, li.URL, redactor)
 }
 
-// IssueCounts returns the total, errors, and warnings counts
-func (li LinkedInLinkScores) IssueCounts() (uint, uint, uint) {
-	if li.IssuesFound == nil {
-		return 0, 0, 0
-	}
-	var errors, warnings uint
-	for _, i := range li.IssuesFound {
-		if i.IsError() {
-			errors++
-		} else {
-			warnings++
-		}
-	}
-	return uint(len(li.IssuesFound)), errors, warnings
+// MarshalJSON adds the Issues and the validity policy, if it can be serialized, to the serialized scores
+func (li LinkedInLinkScores) MarshalJSON() ([]byte, error) {
+	type plain LinkedInLinkScores
+	return marshalWithIssues(plain(li), &li.IssueCollection, li.validity)
 }
 
-// HandleIssues loops through each issue and calls a particular handler
-func (li LinkedInLinkScores) HandleIssues(errorHandler func(Issue), warningHandler func(Issue)) {
-	if li.IssuesFound == nil {
-		return
-	}
-	for _, i := range li.IssuesFound {
-		if i.IsError() && errorHandler != nil {
-			errorHandler(i)
-		}
-		if i.IsWarning() && warningHandler != nil {
-			warningHandler(i)
-		}
-	}
+// UnmarshalJSON rebuilds the concrete Issues so that stored results can be reloaded
+func (li *LinkedInLinkScores) UnmarshalJSON(data []byte) error {
+	type plain LinkedInLinkScores
+	return unmarshalWithIssues(data, (*plain)(li), &li.IssueCollection, &li.validity)
+}
+
+// Issues contains all the problems detected in scoring
+func (li LinkedInLinkScores) Issues() Issues {
+	return &li.IssueCollection
 }
 
 // GetLinkedInLinkScoresForURLText takes a text URL to score and returns the LinkedIn share count
 func GetLinkedInLinkScoresForURLText(url string, client *http.Client, simulateLinkedInAPI bool) *LinkedInLinkScores {
-	apiEndpoint := "https://www.linkedin.com/countserv/count/share?format=json&url=" + url
+	return GetLinkedInLinkScoresForURLTextWithContext(context.Background(), url, client, simulateLinkedInAPI)
+}
+
+// GetLinkedInLinkScoresForURLTextWithContext takes a text URL to score and returns the LinkedIn share count, the API call is aborted if ctx is done
+func GetLinkedInLinkScoresForURLTextWithContext(ctx context.Context, url string, client *http.Client, simulateLinkedInAPI bool) *LinkedInLinkScores {
+	return NewLinkedInScorer(client, simulateLinkedInAPI).scoreURLText(ctx, url)
+}
+
+func (s *LinkedInScorer) scoreURLText(ctx context.Context, url string) *LinkedInLinkScores {
+	apiEndpoint, endpointIssue := buildAPIEndpoint(s.APIBaseURL(), map[string]string{"format": "json", "url": url})
 	result := new(LinkedInLinkScores)
-	result.MachineName = "linkedin"
+	result.validity = s.Validity
+	result.MachineName = LinkedInScorerMachineName
 	result.HumanName = "LinkedIn"
 	result.URL = url
 	result.APIEndpoint = apiEndpoint
-	if simulateLinkedInAPI {
+	defer result.finish(NewRedactor(s.SensitiveParams()...))
+	if endpointIssue != nil {
+		result.Add(endpointIssue)
+		return result
+	}
+	if ctx.Err() != nil {
+		result.Add(newContextIssue(apiEndpoint, ctx.Err()))
+		return result
+	}
+	if s.Simulate {
 		result.Simulated = true
 		result.Count = rand.Intn(50)
 		return result
 	}
-	httpRes, issue := getHTTPResult(apiEndpoint, client, HTTPUserAgent)
-	result.APIEndpoint = httpRes.apiEndpoint
+	call := newAPICall(apiEndpoint, s.Client, s.ProviderPolicies)
+	call.cacheable = isCacheableLinkedInResponse
+	httpRes, issue := getHTTPResult(ctx, call)
+	result.APIAttempts = httpRes.attempts
+	result.Add(httpRes.issues...)
 	if issue != nil {
-		result.IssuesFound = append(result.IssuesFound, issue)
+		result.Add(issue)
+		return result
+	}
+	result.APIEndpoint = httpRes.apiEndpoint
+	var payload linkedInCountPayload
+	if issue := decodeAPIResponseBody(apiEndpoint, *httpRes.body, &payload); issue != nil {
+		result.Add(issue)
+		return result
+	}
+	if payload.Count == nil {
+		result.Add(NewIssue(apiEndpoint, UnexpectedAPIResponseBody, "LinkedIn API response has no count", true))
 		return result
 	}
-	json.Unmarshal(*httpRes.body, result)
+	result.Count = *payload.Count
 	return result
 }
 
+// linkedInCountPayload is the body of LinkedIn's share count API response
+type linkedInCountPayload struct {
+	Count *int `json:"count"`
+}
+
+// isCacheableLinkedInResponse returns true if the body has a count
+func isCacheableLinkedInResponse(body []byte) bool {
+	var payload linkedInCountPayload
+	return json.Unmarshal(body, &payload) == nil && payload.Count != nil
+}
+
 // GetLinkedInLinkScoresForURL takes a URL to score and returns the LinkedIn share count
 func GetLinkedInLinkScoresForURL(url *url.URL, client *http.Client, simulateLinkedInAPI bool) (*LinkedInLinkScores, error) {
 	if url == nil {
@@ -127,3 +230,11 @@ func GetLinkedInLinkScoresForURL(url *url.URL, client *http.Client, simulateLink
 	}
 	return GetLinkedInLinkScoresForURLText(url.String(), client, simulateLinkedInAPI), nil
 }
+
+// GetLinkedInLinkScoresForURLWithContext takes a URL to score and returns the LinkedIn share count, the API call is aborted if ctx is done
+func GetLinkedInLinkScoresForURLWithContext(ctx context.Context, url *url.URL, client *http.Client, simulateLinkedInAPI bool) (*LinkedInLinkScores, error) {
+	if url == nil {
+		return nil, errors.New("Null URL passed to GetLinkedInLinkScoresForURLWithContext")
+	}
+	return GetLinkedInLinkScoresForURLTextWithContext(ctx, url.String(), client, simulateLinkedInAPI), nil
+}
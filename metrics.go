@@ -0,0 +1,104 @@
+package score
+
+// MetricName identifies a kind of engagement measurement (shares, comments, reactions, etc.)
+type MetricName string
+
+// MetricUnit identifies how a metric's value is measured
+type MetricUnit string
+
+// Network identifies the social network a metric was measured on
+type Network string
+
+const (
+	SharesMetric        MetricName = "shares"
+	CommentsMetric      MetricName = "comments"
+	ReactionsMetric     MetricName = "reactions"
+	CommentPluginMetric MetricName = "commentPlugin"
+	PinsMetric          MetricName = "pins"
+	SavesMetric         MetricName = "saves"
+	ViewsMetric         MetricName = "views"
+	PlusOnesMetric      MetricName = "plusOnes"
+)
+
+const (
+	CountUnit MetricUnit = "count"
+)
+
+const (
+	FacebookNetwork    Network = "facebook"
+	LinkedInNetwork    Network = "linkedin"
+	PinterestNetwork   Network = "pinterest"
+	StumbleUponNetwork Network = "stumbleupon"
+	GooglePlusNetwork  Network = "googleplus"
+)
+
+// Metric is a single named measurement reported by a scorer
+type Metric struct {
+	Name    MetricName `json:"name"`
+	Unit    MetricUnit `json:"unit"`
+	Network Network    `json:"network,omitempty"` // empty when the metric spans networks (e.g. aggregates)
+	Value   int        `json:"value"`
+}
+
+// Metrics is the list of measurements reported by a scorer
+type Metrics []Metric
+
+// Value returns the total of all the metrics with the given name across networks, false if there are none
+func (m Metrics) Value(name MetricName) (int, bool) {
+	var total int
+	var found bool
+	for _, metric := range m {
+		if metric.Name == name {
+			total += metric.Value
+			found = true
+		}
+	}
+	return total, found
+}
+
+// NetworkValue returns the value of the named metric for a single network, false if it's not available
+func (m Metrics) NetworkValue(name MetricName, network Network) (int, bool) {
+	for _, metric := range m {
+		if metric.Name == name && metric.Network == network {
+			return metric.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Names returns the distinct metric names in the order they first appear
+func (m Metrics) Names() []MetricName {
+	var result []MetricName
+	seen := make(map[MetricName]bool)
+	for _, metric := range m {
+		if !seen[metric.Name] {
+			seen[metric.Name] = true
+			result = append(result, metric.Name)
+		}
+	}
+	return result
+}
+
+func countMetric(name MetricName, network Network, value int) Metric {
+	return Metric{Name: name, Unit: CountUnit, Network: network, Value: value}
+}
+
+// sumMetrics totals each metric name and unit separately, in the order first seen
+func sumMetrics(metrics []sourcedMetric) Metrics {
+	type key struct {
+		name MetricName
+		unit MetricUnit
+	}
+	var result Metrics
+	index := make(map[key]int)
+	for _, sm := range metrics {
+		k := key{sm.metric.Name, sm.metric.Unit}
+		if i, ok := index[k]; ok {
+			result[i].Value += sm.metric.Value
+			continue
+		}
+		index[k] = len(result)
+		result = append(result, Metric{Name: sm.metric.Name, Unit: sm.metric.Unit, Value: sm.metric.Value})
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package score
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+)
+
+// ScoreFunc has the same signature as ContextLifecycle.ScoreLinkWithContext
+type ScoreFunc func(ctx context.Context, url *url.URL) (LinkScores, Issue)
+
+// Middleware decorates a scorer with cross-cutting behavior (logging, retries, caching, metrics, etc.)
+type Middleware func(Scorer) Scorer
+
+// Chain wraps the scorer in each of the middleware layers, the first middleware is the outermost layer
+func Chain(scorer Scorer, middleware ...Middleware) Scorer {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		scorer = middleware[i](scorer)
+	}
+	return scorer
+}
+
+// WrapScorer creates a scorer with the same names as the given scorer but which scores links using fn
+func WrapScorer(scorer Scorer, fn ScoreFunc) Scorer {
+	return &wrappedScorer{Scorer: scorer, score: fn}
+}
+
+type wrappedScorer struct {
+	Scorer
+	score ScoreFunc
+}
+
+// ScoreLink satisfies the Lifecycle interface
+func (w *wrappedScorer) ScoreLink(url *url.URL) (LinkScores, Issue) {
+	return w.score(context.Background(), url)
+}
+
+// ScoreLinkWithContext satisfies the ContextLifecycle interface
+func (w *wrappedScorer) ScoreLinkWithContext(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+	return w.score(ctx, url)
+}
+
+// Unwrap returns the scorer which was wrapped
+func (w *wrappedScorer) Unwrap() Scorer {
+	return w.Scorer
+}
+
+// ScoreObserver is told about every link scored through ObserverMiddleware
+type ScoreObserver func(machineName string, url *url.URL, elapsed time.Duration, scores LinkScores, issue Issue)
+
+// ObserverMiddleware reports how long each scoring call took and what it returned, useful for collecting metrics
+func ObserverMiddleware(observer ScoreObserver) Middleware {
+	return func(next Scorer) Scorer {
+		return WrapScorer(next, func(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+			started := time.Now()
+			scores, issue := next.ScoreLinkWithContext(ctx, url)
+			observer(next.MachineName(), url, time.Since(started), scores, issue)
+			return scores, issue
+		})
+	}
+}
+
+// LoggingMiddleware logs each scoring call and any issues it found, a nil logger means the standard logger
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.New(log.Writer(), "", log.LstdFlags)
+	}
+	return ObserverMiddleware(func(machineName string, url *url.URL, elapsed time.Duration, scores LinkScores, issue Issue) {
+		if issue != nil {
+			logger.Printf("[%s] %v failed in %v: %s (%s)", machineName, url, elapsed, issue.Issue(), issue.IssueCode())
+			return
+		}
+		logger.Printf("[%s] %v scored in %v", machineName, url, elapsed)
+		if scores != nil && scores.Issues() != nil {
+			for _, i := range scores.Issues().ErrorsAndWarnings() {
+				logger.Printf("[%s] %v issue: %s (%s)", machineName, url, i.Issue(), i.IssueCode())
+			}
+		}
+	})
+}
+
+// WithMiddleware wraps every scorer the aggregator runs in the middleware layers
+func WithMiddleware(middleware ...Middleware) AggregatorOption {
+	return func(a *Aggregator) {
+		a.middleware = append(a.middleware, middleware...)
+	}
+}
+
+// Wrap replaces the named scorer with one wrapped in the middleware layers, returns false if it was not registered
+func (r *Registry) Wrap(machineName string, middleware ...Middleware) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	scorer, exists := r.scorers[machineName]
+	if !exists {
+		return false
+	}
+	r.scorers[machineName] = Chain(scorer, middleware...)
+	return true
+}
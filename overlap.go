@@ -0,0 +1,98 @@
+package score
+
+// DefaultScorerPrecedence ranks the direct providers ahead of SharedCount.com, which re-reports their networks
+var DefaultScorerPrecedence = []string{FacebookScorerMachineName, LinkedInScorerMachineName, SharedCountScorerMachineName}
+
+// NetworkPrecedence ranks scorers (by machine name) for specific networks, earlier scorers are more authoritative
+type NetworkPrecedence map[Network][]string
+
+// sourcedMetric remembers which of the aggregated scores a metric came from
+type sourcedMetric struct {
+	index  int
+	scorer string
+	metric Metric
+}
+
+// collectMetrics gathers the metrics of all the valid scores
+func collectMetrics(scores []LinkScores) []sourcedMetric {
+	var result []sourcedMetric
+	for i, ls := range scores {
+		if !ls.IsValid() {
+			continue
+		}
+		for _, metric := range ls.Metrics() {
+			result = append(result, sourcedMetric{index: i, scorer: ls.SourceID(), metric: metric})
+		}
+	}
+	return result
+}
+
+// rank returns the scorer's position in the network's precedence list (or the default list), unlisted scorers rank last
+func (p NetworkPrecedence) rank(network Network, machineName string, defaultPrecedence []string) int {
+	precedence, ok := p[network]
+	if !ok {
+		precedence = defaultPrecedence
+	}
+	for i, name := range precedence {
+		if name == machineName {
+			return i
+		}
+	}
+	return len(precedence)
+}
+
+// selectAuthoritativeMetrics picks one scorer per network so that overlapping scorers aren't counted twice, metrics which
+// aren't tied to a network are always kept; ties go to the scorer which appears first in the aggregate. The metrics which
+// weren't selected are returned by the index of their scores so they can be taken out of those scores' counts
+func selectAuthoritativeMetrics(metrics []sourcedMetric, defaultPrecedence []string, precedence NetworkPrecedence) ([]sourcedMetric, map[int]Metrics, map[Network]string) {
+	sources := make(map[Network]string)
+	sourceIndex := make(map[Network]int)
+	sourceRank := make(map[Network]int)
+	for _, sm := range metrics {
+		network := sm.metric.Network
+		if network == "" {
+			continue
+		}
+		rank := precedence.rank(network, sm.scorer, defaultPrecedence)
+		if current, ok := sourceRank[network]; !ok || rank < current {
+			sources[network] = sm.scorer
+			sourceIndex[network] = sm.index
+			sourceRank[network] = rank
+		}
+	}
+
+	var selected []sourcedMetric
+	overlapped := make(map[int]Metrics)
+	for _, sm := range metrics {
+		if sm.metric.Network == "" || sourceIndex[sm.metric.Network] == sm.index {
+			selected = append(selected, sm)
+		} else {
+			overlapped[sm.index] = append(overlapped[sm.index], sm.metric)
+		}
+	}
+	return selected, overlapped, sources
+}
+
+// networkSharesCounter is satisfied by scores whose SharesCount spans several networks, e.g. SharedCount's aggregated
+// score which includes Facebook's total engagement and not only its shares
+type networkSharesCounter interface {
+	networkSharesCount(network Network) int
+}
+
+// overlappedSharesCount returns how much of the scores' SharesCount came from the networks of the overlapped metrics,
+// scores which don't say how their count is made up are assumed to count only each network's shares
+func overlappedSharesCount(scores LinkScores, overlapped Metrics) int {
+	counter, spans := scores.(networkSharesCounter)
+	var result int
+	seen := make(map[Network]bool)
+	for _, metric := range overlapped {
+		switch {
+		case spans && !seen[metric.Network]:
+			seen[metric.Network] = true
+			result += counter.networkSharesCount(metric.Network)
+		case !spans && metric.Name == SharesMetric:
+			result += metric.Value
+		}
+	}
+	return result
+}
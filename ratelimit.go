@@ -0,0 +1,86 @@
+package score
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket which limits how often a provider's API is called, share one instance across all
+// the scorers which call the same provider; it's safe for concurrent use
+type RateLimiter struct {
+	mutex    sync.Mutex
+	requests int           // as configured, only used to describe the limit
+	per      time.Duration // as configured, only used to describe the limit
+	rate     float64       // tokens added per second
+	burst    float64
+	tokens   float64
+	last     time.Time
+	wait     bool
+}
+
+// NewRateLimiter allows the given number of requests per interval (e.g. 5 per time.Second or 200 per time.Hour) with
+// bursts of up to burst requests (at least 1); when wait is true calls wait for their turn, otherwise calls which would
+// exceed the budget fail fast with a RateLimitExceeded Issue
+func NewRateLimiter(requests int, per time.Duration, burst int, wait bool) *RateLimiter {
+	result := new(RateLimiter)
+	result.requests = requests
+	result.per = per
+	result.rate = float64(requests) / per.Seconds()
+	result.burst = math.Max(float64(burst), 1)
+	result.tokens = result.burst
+	result.last = time.Now()
+	result.wait = wait
+	return result
+}
+
+// refill adds the tokens earned since the last call, the mutex must be held
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// Available returns how many requests could be made right now without waiting
+func (l *RateLimiter) Available() float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.refill(time.Now())
+	return math.Max(l.tokens, 0)
+}
+
+// acquire takes a token for a request to apiEndpoint, waiting for it if the limiter is configured to
+func (l *RateLimiter) acquire(ctx context.Context, apiEndpoint string) Issue {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	l.refill(time.Now())
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mutex.Unlock()
+		return nil
+	}
+	if !l.wait || l.rate <= 0 {
+		l.mutex.Unlock()
+		return NewIssue(apiEndpoint, RateLimitExceeded, fmt.Sprintf("Rate limit of %d requests per %v exceeded", l.requests, l.per), true)
+	}
+	// the token is reserved now (going into debt) so that waiting callers are served in order
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return newContextIssue(apiEndpoint, ctx.Err())
+	}
+}
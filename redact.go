@@ -0,0 +1,158 @@
+package score
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values in endpoints, Issue messages and contexts
+const RedactedValue = "REDACTED"
+
+// DefaultSensitiveParams are query parameters which are always redacted, whichever provider they're sent to
+var DefaultSensitiveParams = []string{"apikey", "api_key", "access_token", "client_secret"}
+
+// SensitiveParameters is satisfied by scorers which declare which of their API query parameters hold credentials
+type SensitiveParameters interface {
+	SensitiveParams() []string
+}
+
+// Redactor masks credentials in endpoints and text before they're stored, logged or serialized
+type Redactor struct {
+	params   map[string]bool
+	patterns []*regexp.Regexp
+	secrets  []string
+}
+
+// NewRedactor creates a redactor for the sensitive query parameters plus DefaultSensitiveParams
+func NewRedactor(sensitiveParams ...string) *Redactor {
+	result := new(Redactor)
+	result.params = make(map[string]bool)
+	for _, param := range append(append([]string{}, DefaultSensitiveParams...), sensitiveParams...) {
+		name := strings.ToLower(param)
+		if result.params[name] {
+			continue
+		}
+		result.params[name] = true
+		result.patterns = append(result.patterns, regexp.MustCompile(`(?i)(\b`+regexp.QuoteMeta(param)+`=)[^&\s"'#]+`))
+	}
+	return result
+}
+
+// MinimumSecretLength is the length below which AddSecret ignores a secret, masking every occurrence of a very short
+// string would mangle unrelated text (sensitive query parameters are still masked whatever their length)
+const MinimumSecretLength = 4
+
+// AddSecret makes the redactor mask the secret (e.g. an API key) wherever it appears, whether it's literal, query or
+// path escaped, or escaped inside a JSON string
+func (r *Redactor) AddSecret(secret string) {
+	if len(secret) < MinimumSecretLength {
+		return
+	}
+	quoted, _ := json.Marshal(secret)
+	for _, form := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret), string(quoted[1 : len(quoted)-1])} {
+		known := false
+		for _, existing := range r.secrets {
+			known = known || existing == form
+		}
+		if !known {
+			r.secrets = append(r.secrets, form)
+		}
+	}
+	// longer forms go first so a form which contains another is masked as a whole
+	sort.SliceStable(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// Endpoint masks the values of sensitive query parameters in the endpoint
+func (r *Redactor) Endpoint(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || len(parsed.RawQuery) == 0 {
+		return r.Text(endpoint)
+	}
+	query := parsed.Query()
+	redacted := false
+	for name := range query {
+		if r.params[strings.ToLower(name)] {
+			query.Set(name, RedactedValue)
+			redacted = true
+		}
+	}
+	if redacted {
+		parsed.RawQuery = query.Encode()
+	}
+	return r.Text(parsed.String())
+}
+
+// Text masks sensitive parameters (e.g. in URLs quoted by Go errors) and secrets anywhere in the text
+func (r *Redactor) Text(text string) string {
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllString(text, "${1}"+RedactedValue)
+	}
+	for _, secret := range r.secrets {
+		text = strings.Replace(text, secret, RedactedValue, -1)
+	}
+	return text
+}
+
+// Issue returns a copy of the Issue with its message and context redacted, Issues which weren't created by
+// this package are returned as they are
+func (r *Redactor) Issue(i Issue) Issue {
+	var result issue
+	switch concrete := i.(type) {
+	case *issue:
+		result = *concrete
+	case issue:
+		result = concrete
+	default:
+		return i
+	}
+	result.Context.APIEndpoint = r.Endpoint(result.Context.APIEndpoint)
+	result.Context.TargetURL = r.Endpoint(result.Context.TargetURL)
+	result.Message = r.Text(result.Message)
+	result.cause = r.Error(result.cause)
+	return &result
+}
+
+// Error masks credentials in an Issue's underlying error, a *url.Error keeps its type (so errors.As still works) with
+// its URL redacted, any other error which mentions a credential is replaced by one that unwraps to what it wrapped
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		return &url.Error{Op: urlErr.Op, URL: r.Endpoint(urlErr.URL), Err: r.Error(urlErr.Err)}
+	}
+	message := r.Text(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{message: message, cause: r.Error(errors.Unwrap(err))}
+}
+
+type redactedError struct {
+	message string
+	cause   error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.cause
+}
+
+// Issues redacts each of the Issues
+func (r *Redactor) Issues(issues []Issue) []Issue {
+	if issues == nil {
+		return nil
+	}
+	result := make([]Issue, len(issues))
+	for index, i := range issues {
+		result[index] = r.Issue(i)
+	}
+	return result
+}
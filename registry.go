@@ -0,0 +1,159 @@
+package score
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Scorer is a named scoring provider (Facebook, LinkedIn, etc.) which satisfies the Lifecycle interfaces
+type Scorer interface {
+	Lifecycle
+	ContextLifecycle
+	MachineName() string
+	HumanName() string
+}
+
+// Registry keeps track of scorers by machine name and whether each one is enabled
+type Registry struct {
+	mutex   sync.RWMutex
+	order   []string
+	scorers map[string]Scorer
+	enabled map[string]bool
+}
+
+// DefaultRegistry is where the built-in providers register themselves
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty scorer registry
+func NewRegistry() *Registry {
+	result := new(Registry)
+	result.scorers = make(map[string]Scorer)
+	result.enabled = make(map[string]bool)
+	return result
+}
+
+// Register adds the scorer under its machine name and enables it
+func (r *Registry) Register(scorer Scorer) error {
+	if scorer == nil {
+		return errors.New("Null scorer passed to Registry.Register")
+	}
+	name := scorer.MachineName()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.scorers[name]; exists {
+		return fmt.Errorf("Scorer %q is already registered", name)
+	}
+	r.order = append(r.order, name)
+	r.scorers[name] = scorer
+	r.enabled[name] = true
+	return nil
+}
+
+// Unregister removes the named scorer, returns false if it was not registered
+func (r *Registry) Unregister(machineName string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.scorers[machineName]; !exists {
+		return false
+	}
+	delete(r.scorers, machineName)
+	delete(r.enabled, machineName)
+	for i, name := range r.order {
+		if name == machineName {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Lookup finds a registered scorer by its machine name
+func (r *Registry) Lookup(machineName string) (Scorer, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	scorer, ok := r.scorers[machineName]
+	return scorer, ok
+}
+
+// MachineNames returns the names of all registered scorers in registration order
+func (r *Registry) MachineNames() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	result := make([]string, len(r.order))
+	copy(result, r.order)
+	return result
+}
+
+// Scorers returns all registered scorers in registration order, enabled or not
+func (r *Registry) Scorers() []Scorer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	result := make([]Scorer, 0, len(r.order))
+	for _, name := range r.order {
+		result = append(result, r.scorers[name])
+	}
+	return result
+}
+
+// EnabledScorers returns the enabled scorers in registration order
+func (r *Registry) EnabledScorers() []Scorer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var result []Scorer
+	for _, name := range r.order {
+		if r.enabled[name] {
+			result = append(result, r.scorers[name])
+		}
+	}
+	return result
+}
+
+// Enable turns on the named scorer, returns false if it was not registered
+func (r *Registry) Enable(machineName string) bool {
+	return r.setEnabled(machineName, true)
+}
+
+// Disable turns off the named scorer, returns false if it was not registered
+func (r *Registry) Disable(machineName string) bool {
+	return r.setEnabled(machineName, false)
+}
+
+// IsEnabled returns true if the named scorer is registered and enabled
+func (r *Registry) IsEnabled(machineName string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.enabled[machineName]
+}
+
+func (r *Registry) setEnabled(machineName string, enabled bool) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.scorers[machineName]; !exists {
+		return false
+	}
+	r.enabled[machineName] = enabled
+	return true
+}
+
+// ScoreLink runs each enabled scorer against the URL and returns the scores in registration order
+func (r *Registry) ScoreLink(url *url.URL) ([]LinkScores, []Issue) {
+	return r.ScoreLinkWithContext(context.Background(), url)
+}
+
+// ScoreLinkWithContext runs each enabled scorer against the URL until ctx is done and returns the scores in registration order
+func (r *Registry) ScoreLinkWithContext(ctx context.Context, url *url.URL) ([]LinkScores, []Issue) {
+	var scores []LinkScores
+	var issues []Issue
+	for _, scorer := range r.EnabledScorers() {
+		ls, issue := scorer.ScoreLinkWithContext(ctx, url)
+		if issue != nil {
+			issues = append(issues, issue)
+			continue
+		}
+		scores = append(scores, ls)
+	}
+	return scores, issues
+}
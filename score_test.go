@@ -1,11 +1,20 @@
 package score
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/lectio/secret"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -70,3 +79,986 @@ func (suite *ScoreSuite) TestScores() {
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(ScoreSuite))
 }
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{FacebookScorerMachineName, LinkedInScorerMachineName, SharedCountScorerMachineName}, DefaultRegistry.MachineNames())
+	assert.False(DefaultRegistry.IsEnabled(SharedCountScorerMachineName), "SharedCount needs credentials so it should be disabled by default")
+
+	registry := NewRegistry()
+	assert.Nil(registry.Register(NewFacebookScorer(nil, SimulateFacebookAPI)))
+	assert.Nil(registry.Register(NewLinkedInScorer(nil, SimulateLinkedInAPI)))
+	assert.NotNil(registry.Register(NewLinkedInScorer(nil, SimulateLinkedInAPI)), "Duplicate machine names should be rejected")
+
+	scorer, found := registry.Lookup(LinkedInScorerMachineName)
+	assert.True(found)
+	assert.Equal("LinkedIn", scorer.HumanName())
+
+	assert.True(registry.Disable(FacebookScorerMachineName))
+	assert.False(registry.Disable("unknown"))
+	assert.Len(registry.EnabledScorers(), 1)
+
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	scores, issues := registry.ScoreLink(scoreURL)
+	assert.Len(issues, 0)
+	assert.Len(scores, 1)
+	assert.Equal(LinkedInScorerMachineName, scores[0].SourceID())
+	assert.True(scores[0].IsValid())
+}
+
+func TestContextDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, issue := getHTTPResult(ctx, &apiCall{apiEndpoint: hung.URL, client: hung.Client(), userAgent: HTTPUserAgent})
+	assert.NotNil(issue)
+	assert.Equal(ScoringDeadlineExceeded, issue.IssueCode())
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	fb := GetFacebookLinkScoresForURLTextWithContext(cancelled, "https://www.lectio.com/", hung.Client(), UseFacebookAPI)
+	assert.False(fb.IsValid())
+	assert.Equal(ScoringCancelled, fb.ErrorsAndWarnings()[0].IssueCode())
+}
+
+// fakeScorer is a LinkedIn scorer whose outcome is decided by its fields, checked in order: while release is open it
+// hangs (ignoring its context, so aggregation must time it out), it panics for URLs whose path is panicPath, and it
+// returns scores if they're set; otherwise it scores like its LinkedInScorer
+type fakeScorer struct {
+	LinkedInScorer
+	name      string // defaults to the machine name of scores, if they're set
+	release   chan struct{}
+	panicPath string
+	scores    LinkScores
+}
+
+// newHungScorer returns a scorer named "hung" which hangs until its release channel is closed
+func newHungScorer() *fakeScorer {
+	return &fakeScorer{name: "hung", release: make(chan struct{})}
+}
+
+func (s *fakeScorer) MachineName() string {
+	switch {
+	case len(s.name) > 0:
+		return s.name
+	case s.scores != nil:
+		return s.scores.SourceID()
+	}
+	return s.LinkedInScorer.MachineName()
+}
+
+func (s *fakeScorer) ScoreLinkWithContext(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+	if s.release != nil {
+		<-s.release
+		return nil, nil
+	}
+	if len(s.panicPath) > 0 && url.Path == s.panicPath {
+		panic("unexpected response")
+	}
+	if s.scores != nil {
+		return s.scores, nil
+	}
+	return s.LinkedInScorer.ScoreLinkWithContext(ctx, url)
+}
+
+func TestAggregateTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	hung := newHungScorer()
+	defer close(hung.release)
+
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	aggregator := NewAggregator(
+		WithScorer(hung),
+		WithFacebook(SimulateFacebookAPI),
+		WithLinkedIn(SimulateLinkedInAPI),
+		WithScorerTimeout("hung", 50*time.Millisecond))
+	aggregated := aggregator.Aggregate(context.Background(), scoreURL)
+
+	assert.Len(aggregated.Scores, 2)
+	assert.Equal(FacebookScorerMachineName, aggregated.Scores[0].SourceID())
+	assert.Equal(LinkedInScorerMachineName, aggregated.Scores[1].SourceID())
+	assert.False(aggregated.IsValid(), "A timed out scorer should invalidate the aggregate")
+	issues := aggregated.ErrorsAndWarnings()
+	assert.Len(issues, 1)
+	assert.Equal(ScoringDeadlineExceeded, issues[0].IssueCode())
+
+	serialized, err := json.Marshal(aggregated)
+	assert.NoError(err)
+	reloaded := new(AggregatedLinkScores)
+	assert.NoError(json.Unmarshal(serialized, reloaded))
+	assert.Len(reloaded.FromProvider("hung"), 1, "The aggregate's own issues should still be serialized")
+}
+
+func TestAggregatorOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	aggregator := NewAggregator(
+		WithFacebook(SimulateFacebookAPI),
+		WithSharedCount(EnvSharedCountCredentials{}, SimulateSharedCountAPI))
+	assert.Len(aggregator.Scorers(), 2)
+
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	aggregated := aggregator.Aggregate(context.Background(), scoreURL)
+	assert.True(aggregated.IsValid())
+	assert.True(aggregated.Simulated)
+	assert.Equal(FacebookScorerMachineName, aggregated.Scores[0].SourceID())
+	assert.Equal(SharedCountScorerMachineName, aggregated.Scores[1].SourceID())
+
+	fbShares, _ := aggregated.Scores[0].Metrics().NetworkValue(SharesMetric, FacebookNetwork)
+	shares, found := aggregated.Metrics().Value(SharesMetric)
+	assert.True(found)
+	assert.Equal(fbShares, shares, "Simulated SharedCount only fills in its aggregated score so shares should only come from Facebook")
+	_, found = aggregated.Metrics().Value(PinsMetric)
+	assert.True(found, "Pins should be summed even though only SharedCount reports them")
+}
+
+func TestCompositeScore(t *testing.T) {
+	assert := assert.New(t)
+
+	fb := &FacebookLinkScores{MachineName: FacebookScorerMachineName, Shares: &FacebookGraphShares{ShareCount: 10, CommentCount: 4}}
+	li := &LinkedInLinkScores{MachineName: LinkedInScorerMachineName, Count: 3}
+	weights := CompositeWeights{
+		LinkedInScorerMachineName: {SharesMetric: 5},
+		AnyScorer:                 {SharesMetric: 1, CommentsMetric: 0.5},
+	}
+
+	composite := ComputeCompositeScore([]LinkScores{fb, li}, weights)
+	assert.Equal(27.0, composite.Score)
+	assert.Len(composite.Breakdown, 3)
+	assert.Equal(map[string]float64{FacebookScorerMachineName: 12, LinkedInScorerMachineName: 15}, composite.ScorerTotals())
+}
+
+func TestOverlappingScorers(t *testing.T) {
+	assert := assert.New(t)
+
+	fb := &fakeScorer{scores: &FacebookLinkScores{MachineName: FacebookScorerMachineName, Shares: &FacebookGraphShares{ShareCount: 10, CommentCount: 4}}}
+	li := &fakeScorer{scores: &LinkedInLinkScores{MachineName: LinkedInScorerMachineName, Count: 3}}
+	sc := &fakeScorer{scores: &SharedCountLinkScores{MachineName: SharedCountScorerMachineName, AggregatedScore: 110, LinkedIn: 5, Pinterest: 2,
+		Facebook: SharedCountFacebookScores{TotalCount: 103, ShareCount: 100, CommentCount: 3}}}
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+
+	aggregated := NewAggregator(WithScorer(sc)).Aggregate(context.Background(), scoreURL)
+	assert.Equal(110, aggregated.SharesCount(), "Without overlap SharedCount's aggregated score should be counted as is")
+	assert.Equal(3, aggregated.CommentsCount())
+
+	aggregated = NewAggregator(WithScorer(sc), WithScorer(fb), WithScorer(li)).Aggregate(context.Background(), scoreURL)
+	assert.Equal(10+3+(110-103-5), aggregated.SharesCount(), "Facebook and LinkedIn engagement should come from the direct scorers only, the rest of SharedCount's score should still count")
+	assert.Equal(4, aggregated.CommentsCount())
+	assert.Equal(FacebookScorerMachineName, aggregated.NetworkSources[FacebookNetwork])
+	assert.Equal(SharedCountScorerMachineName, aggregated.NetworkSources[PinterestNetwork])
+	pins, _ := aggregated.Metrics().Value(PinsMetric)
+	assert.Equal(2, pins)
+
+	aggregated = NewAggregator(WithScorer(sc), WithScorer(fb), WithScorer(li),
+		WithNetworkPrecedence(FacebookNetwork, SharedCountScorerMachineName)).Aggregate(context.Background(), scoreURL)
+	assert.Equal((110-5)+3, aggregated.SharesCount())
+	assert.Equal(SharedCountScorerMachineName, aggregated.NetworkSources[FacebookNetwork])
+
+	reacted := &fakeScorer{scores: &SharedCountLinkScores{MachineName: SharedCountScorerMachineName, AggregatedScore: 20,
+		Facebook: SharedCountFacebookScores{TotalCount: 20, ShareCount: 10, CommentCount: 5, ReactionCount: 5}}}
+	direct := &fakeScorer{scores: &FacebookLinkScores{MachineName: FacebookScorerMachineName, Shares: &FacebookGraphShares{ShareCount: 10, CommentCount: 5}}}
+	aggregated = NewAggregator(WithScorer(reacted), WithScorer(direct)).Aggregate(context.Background(), scoreURL)
+	assert.Equal(10, aggregated.SharesCount(), "SharedCount's Facebook comments and reactions shouldn't be counted as shares")
+	assert.Equal(5, aggregated.CommentsCount())
+}
+
+func TestAggregateBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var urls []*url.URL
+	for _, text := range []string{"https://www.lectio.com/a", "https://www.lectio.com/panic", "https://www.lectio.com/b"} {
+		u, _ := url.Parse(text)
+		urls = append(urls, u)
+	}
+
+	noisy := new(LinkedInLinkScores)
+	noisy.MachineName = "noisy"
+	noisy.Add(
+		NewClassifiedIssue("test", APIErrorResponseFound, "Attempt 1 of 2 failed, retrying", WarningSeverity, UncategorizedIssue),
+		NewIssue("test", UnexpectedAPIResponseBody, "No count", true))
+
+	aggregator := NewAggregator(
+		WithFacebook(SimulateFacebookAPI),
+		WithScorer(&fakeScorer{LinkedInScorer: LinkedInScorer{Simulate: SimulateLinkedInAPI}, panicPath: "/panic"}),
+		WithScorer(&fakeScorer{scores: noisy}),
+		WithValidityPolicy(IssueValidityPolicy{IgnoredCodes: []string{UnexpectedAPIResponseBody}}),
+		WithBatchConcurrency(2))
+	batch := aggregator.AggregateBatch(context.Background(), urls)
+
+	assert.Len(batch.Results, 3)
+	assert.Equal("https://www.lectio.com/b", batch.Results[2].URL)
+	assert.Equal(2, batch.SucceededCount())
+	assert.Equal(1, batch.FailedCount())
+	assert.Equal("https://www.lectio.com/panic", batch.Failures[0].URL)
+	assert.Equal(map[string]int{ScorerPanicked: 1}, batch.IssueCodeCounts(), "Warnings and ignored codes didn't make the URL fail")
+	assert.Len(batch.Results[1].Scores, 2, "The other scores should survive the LinkedIn panic")
+}
+
+type sliceIterator struct {
+	urls []*url.URL
+}
+
+func (it *sliceIterator) Next() (*url.URL, bool) {
+	if len(it.urls) == 0 {
+		return nil, false
+	}
+	u := it.urls[0]
+	it.urls = it.urls[1:]
+	return u, true
+}
+
+func TestAggregateStream(t *testing.T) {
+	assert := assert.New(t)
+
+	it := new(sliceIterator)
+	for i := 0; i < 5; i++ {
+		u, _ := url.Parse(fmt.Sprintf("https://www.lectio.com/%d", i))
+		it.urls = append(it.urls, u)
+	}
+
+	aggregator := NewAggregator(WithFacebook(SimulateFacebookAPI), WithBatchConcurrency(2))
+	seen := make(map[int]bool)
+	for streamed := range aggregator.AggregateStream(context.Background(), IterateURLs(context.Background(), it)) {
+		aggregated, ok := streamed.Aggregated()
+		assert.True(ok)
+		assert.Equal(streamed.URL.String(), aggregated.URL)
+		seen[streamed.Index] = true
+	}
+	assert.Len(seen, 5)
+
+	hung := newHungScorer()
+	ctx, cancel := context.WithCancel(context.Background())
+	urls := make(chan *url.URL)
+	stream := StreamLinkScores(ctx, hung, urls, 2)
+	for i := 0; i < 2; i++ {
+		u, _ := url.Parse(fmt.Sprintf("https://www.lectio.com/hung/%d", i))
+		urls <- u
+	}
+	cancel()
+	close(hung.release)
+	var late int
+	closed := make(chan struct{})
+	go func() {
+		for range stream {
+			late++
+		}
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("The stream should close once it's cancelled, even though urls is still open")
+	}
+	assert.Equal(0, late, "URLs which finish scoring after cancellation shouldn't be emitted")
+}
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	var layers []string
+	layer := func(name string) Middleware {
+		return func(next Scorer) Scorer {
+			return WrapScorer(next, func(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+				layers = append(layers, name)
+				return next.ScoreLinkWithContext(ctx, url)
+			})
+		}
+	}
+
+	var observed []string
+	observer := ObserverMiddleware(func(machineName string, url *url.URL, elapsed time.Duration, scores LinkScores, issue Issue) {
+		observed = append(observed, machineName)
+	})
+
+	registry := NewRegistry()
+	registry.Register(NewLinkedInScorer(nil, SimulateLinkedInAPI))
+	assert.True(registry.Wrap(LinkedInScorerMachineName, layer("outer"), layer("inner"), observer))
+	assert.False(registry.Wrap("unknown", observer))
+
+	scorer, _ := registry.Lookup(LinkedInScorerMachineName)
+	assert.Equal(LinkedInScorerMachineName, scorer.MachineName(), "Wrapped scorers should keep their names")
+
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	scores, issue := scorer.ScoreLink(scoreURL)
+	assert.Nil(issue)
+	assert.True(scores.IsValid())
+	assert.Equal([]string{"outer", "inner"}, layers)
+	assert.Equal([]string{LinkedInScorerMachineName}, observed)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"Please retry","type":"OAuthException","is_transient":true,"code":1,"fbtrace_id":"Abc"}}`))
+		default:
+			w.Write([]byte(`{"count":7}`))
+		}
+	}))
+	defer flaky.Close()
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	var waited []time.Duration
+	sleep := func(ctx context.Context, delay time.Duration) error {
+		waited = append(waited, delay)
+		return nil
+	}
+	httpRes, issue := getHTTPResult(context.Background(), &apiCall{apiEndpoint: flaky.URL, client: flaky.Client(), retry: policy, isTransient: isTransientFacebookGraphAPIError, sleep: sleep})
+	assert.Nil(issue)
+	assert.Equal(3, httpRes.attempts)
+	assert.Len(httpRes.issues, 2)
+	assert.True(httpRes.issues[0].IsWarning())
+	assert.Equal(InvalidAPIRespHTTPStatusCode+"-HTTP-429", httpRes.issues[0].IssueCode())
+	assert.Equal([]time.Duration{time.Second, 2 * time.Millisecond}, waited, "Retry-After should be honored, then the policy's backoff")
+
+	requests = 1
+	httpRes, issue = getHTTPResult(context.Background(), &apiCall{apiEndpoint: flaky.URL, client: flaky.Client(), retry: policy})
+	assert.NotNil(issue, "Without the transient check a 400 shouldn't be retried")
+	assert.Equal(1, httpRes.attempts)
+}
+
+func TestResponseCache(t *testing.T) {
+	assert := assert.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"count":%d}`, atomic.AddInt32(&hits, 1))
+	}))
+	defer server.Close()
+
+	memory := NewMemoryCache(1)
+	policies := ProviderPolicies{Cache: &CachePolicy{Cache: memory, TTL: time.Hour}}
+	first, _ := getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), policies))
+	second, _ := getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), policies))
+	assert.Equal(int32(1), atomic.LoadInt32(&hits), "The second call should be served from the cache")
+	assert.Equal(*first.body, *second.body)
+	assert.Equal(0, second.attempts)
+
+	getHTTPResult(context.Background(), newAPICall(server.URL+"/other", server.Client(), policies))
+	assert.Equal(1, memory.Len(), "The least recently used response should be evicted")
+
+	stale := ProviderPolicies{Cache: &CachePolicy{Cache: memory, TTL: time.Nanosecond, ServeStale: true}}
+	served, _ := getHTTPResult(context.Background(), newAPICall(server.URL+"/other", server.Client(), stale))
+	assert.Equal(`{"count":2}`, string(*served.body), "The stale response should be served while revalidating")
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&hits) < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(int32(3), atomic.LoadInt32(&hits), "The stale response should have been refreshed in the background")
+
+	transient := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"is_transient":true}}`)
+	}))
+	defer transient.Close()
+	retried := ProviderPolicies{Cache: &CachePolicy{Cache: NewMemoryCache(1)}, Retry: &RetryPolicy{MaxAttempts: 2}}
+	call := newAPICall(transient.URL, transient.Client(), retried)
+	call.isTransient = func(body []byte) bool { return true }
+	exhausted, issue := getHTTPResult(context.Background(), call)
+	assert.Nil(issue)
+	assert.True(exhausted.transient)
+	assert.Equal(2, exhausted.attempts)
+	_, found, _ := retried.Cache.lookup(call.cacheKey())
+	assert.False(found, "A transient error which exhausted the retries shouldn't be cached")
+
+	var emptyHits int32
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&emptyHits, 1)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer empty.Close()
+	unscorable := NewMemoryCache(1)
+	linkedIn := &LinkedInScorer{Client: empty.Client(), BaseURL: empty.URL, ProviderPolicies: ProviderPolicies{Cache: &CachePolicy{Cache: unscorable, TTL: time.Hour}}}
+	for i := 0; i < 2; i++ {
+		scores := linkedIn.scoreURLText(context.Background(), "https://www.lectio.news")
+		assert.Equal(UnexpectedAPIResponseBody, scores.ErrorsAndWarnings()[0].IssueCode())
+	}
+	assert.Equal(int32(2), atomic.LoadInt32(&emptyHits), "A body the provider can't score shouldn't be served from the cache")
+	assert.Equal(0, unscorable.Len())
+	assert.False(isCacheableFacebookGraphResponse([]byte(`{"error":{"message":"Invalid OAuth access token.","code":190}}`)))
+	assert.True(isCacheableFacebookGraphResponse([]byte(`{"id":"https://www.lectio.news"}`)))
+	assert.False(isCacheableSharedCountResponse([]byte(`{"Error":"Invalid API key","Type":"invalid_api_key"}`)))
+	assert.False(isCacheableSharedCountResponse([]byte(`not json`)))
+
+	disk, err := NewDiskCache(t.TempDir())
+	assert.Nil(err)
+	disk.Set(server.URL, &CachedResponse{Body: []byte(`{}`), StoredAt: time.Now()})
+	cached, found := disk.Get(server.URL)
+	assert.True(found)
+	assert.Equal(`{}`, string(cached.Body))
+	disk.Delete(server.URL)
+	_, found = disk.Get(server.URL)
+	assert.False(found)
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	failFast := NewRateLimiter(1, time.Hour, 1, false)
+	assert.Nil(failFast.acquire(context.Background(), "test"))
+	issue := failFast.acquire(context.Background(), "test")
+	assert.NotNil(issue)
+	assert.Equal(RateLimitExceeded, issue.IssueCode())
+	assert.Equal("Rate limit of 1 requests per 1h0m0s exceeded", issue.Issue(), "The limit should be described as it was configured")
+
+	waiting := NewRateLimiter(20, time.Second, 1, true)
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Nil(waiting.acquire(context.Background(), "test"))
+	}
+	assert.True(time.Since(started) >= 90*time.Millisecond, "The second and third requests should wait for tokens")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	issue = waiting.acquire(ctx, "test")
+	assert.Equal(ScoringCancelled, issue.IssueCode())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var healthy int32
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"count":1}`))
+	}))
+	defer server.Close()
+
+	breaker := NewCircuitBreaker(LinkedInScorerMachineName, CircuitBreakerSettings{WindowSize: 2, MinimumCalls: 2, FailureRateThreshold: 0.5, CoolDown: 50 * time.Millisecond})
+	policies := ProviderPolicies{CircuitBreaker: breaker}
+	for i := 0; i < 2; i++ {
+		getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), policies))
+	}
+	assert.Equal(CircuitOpen, breaker.State())
+
+	_, issue := getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), policies))
+	assert.Equal(ProviderUnavailable, issue.IssueCode())
+	assert.Equal(int32(2), atomic.LoadInt32(&hits), "An open circuit shouldn't call the provider")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(CircuitHalfOpen, breaker.State())
+	atomic.StoreInt32(&healthy, 1)
+	_, issue = getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), policies))
+	assert.Nil(issue)
+
+	status := breaker.Status()
+	assert.Equal(CircuitClosed, status.State)
+	assert.Equal(uint64(3), status.TotalCalls)
+	assert.Equal(uint64(1), status.TotalRejected)
+	assert.Equal(uint64(1), status.TotalTimesOpened)
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	patient := NewCircuitBreaker(LinkedInScorerMachineName, CircuitBreakerSettings{WindowSize: 1, MinimumCalls: 1, FailureRateThreshold: 0.5, CoolDown: time.Hour})
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, issue = getHTTPResult(ctx, newAPICall(slow.URL, slow.Client(), ProviderPolicies{CircuitBreaker: patient}))
+		cancel()
+		assert.Equal(ScoringDeadlineExceeded, issue.IssueCode())
+	}
+	assert.Equal(CircuitClosed, patient.State(), "The caller's deadline says nothing about the provider's health")
+	assert.Equal(0, patient.Status().WindowFailures)
+
+	zero := NewCircuitBreaker(LinkedInScorerMachineName, CircuitBreakerSettings{})
+	for i := 0; i < 10; i++ {
+		_, issue = getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), ProviderPolicies{CircuitBreaker: zero}))
+		assert.Nil(issue)
+	}
+	assert.Equal(CircuitClosed, zero.State(), "Zero settings should fall back to the defaults rather than open on success")
+
+	stale := NewCircuitBreaker(LinkedInScorerMachineName, CircuitBreakerSettings{WindowSize: 1, MinimumCalls: 1, FailureRateThreshold: 0.5, CoolDown: 10 * time.Millisecond})
+	early, _ := stale.allow("test")
+	failing, _ := stale.allow("test")
+	stale.record(failing, callFailed)
+	assert.Equal(CircuitOpen, stale.State())
+	time.Sleep(20 * time.Millisecond)
+	probe, issue := stale.allow("test")
+	assert.Nil(issue)
+	stale.record(early, callSucceeded)
+	assert.Equal(CircuitHalfOpen, stale.State(), "A call allowed before the circuit opened isn't a probe")
+	_, issue = stale.allow("test")
+	assert.Equal(ProviderUnavailable, issue.IssueCode(), "The probe is still in flight")
+	stale.record(probe, callSucceeded)
+	assert.Equal(CircuitClosed, stale.State())
+	assert.Equal(uint64(3), stale.Status().TotalCalls)
+}
+
+func TestFacebookAPIErrorIssue(t *testing.T) {
+	assert := assert.New(t)
+
+	apiError := decodeFacebookGraphAPIError([]byte(`{"error":{"message":"Invalid OAuth access token.","type":"OAuthException","code":190,"error_subcode":460,"fbtrace_id":"EJplcsCHuLu"}}`))
+	assert.NotNil(apiError)
+	issue := apiError.issue("https://graph.facebook.com/")
+	assert.Equal(APIErrorResponseFound, issue.IssueCode())
+	assert.True(issue.IsError())
+	providerError, ok := issue.(ProviderError)
+	assert.True(ok)
+	assert.Equal("190/460", providerError.ProviderCode())
+	assert.Equal("EJplcsCHuLu", providerError.ProviderTraceID())
+
+	assert.Nil(decodeFacebookGraphAPIError([]byte(`not json`)))
+	assert.NotNil(decodeAPIResponseBody("test", []byte(`not json`), new(FacebookLinkScores)))
+}
+
+type staticSharedCountCredentials string
+
+func (c staticSharedCountCredentials) SharedCountAPIKey() (string, bool, Issue) {
+	return string(c), true, nil
+}
+
+func TestProviderBaseURLs(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/facebook/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"(#4) Application request limit reached","type":"OAuthException","code":4,"fbtrace_id":"AbC"}}`))
+	})
+	mux.HandleFunc("/linkedin", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/sharedcount/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Facebook":{"total_count":12,"share_count":10},"LinkedIn":3,"Pinterest":1}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	aggregator := NewAggregator(
+		WithHTTPClient(server.Client()),
+		WithFacebook(UseFacebookAPI),
+		WithLinkedIn(UseLinkedInAPI),
+		WithSharedCount(staticSharedCountCredentials("secret"), UseSharedCountAPI),
+		WithBaseURL(FacebookScorerMachineName, server.URL+"/facebook/"),
+		WithBaseURL(LinkedInScorerMachineName, server.URL+"/linkedin"),
+		WithBaseURL(SharedCountScorerMachineName, server.URL+"/sharedcount/"))
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	aggregated := aggregator.Aggregate(context.Background(), scoreURL)
+	assert.Len(aggregated.Scores, 3)
+
+	fb := aggregated.Scores[0].(*FacebookLinkScores)
+	assert.False(fb.IsValid(), "A Graph API error should invalidate the scores")
+	assert.Equal(4, fb.APIError.Code)
+	assert.Equal("AbC", fb.ErrorsAndWarnings()[0].(ProviderError).ProviderTraceID())
+
+	li := aggregated.Scores[1].(*LinkedInLinkScores)
+	assert.Equal(UnexpectedAPIResponseBody, li.ErrorsAndWarnings()[0].IssueCode())
+
+	sc := aggregated.Scores[2].(*SharedCountLinkScores)
+	assert.True(sc.IsValid())
+	assert.Equal(16, sc.SharesCount())
+	assert.Equal(SharedCountScorerMachineName, aggregated.NetworkSources[FacebookNetwork], "SharedCount should stand in for the failed direct scorers")
+}
+
+func TestAPIEndpointEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": r.URL.Query().Get("id"), "share": map[string]int{"share_count": 1}})
+	}))
+	defer server.Close()
+
+	target := "https://www.lectio.com/search?q=a&b=c#results"
+	scorer := NewFacebookScorer(server.Client(), UseFacebookAPI)
+	scorer.BaseURL = server.URL + "/v3.2/?access_token=abc"
+	fb := scorer.scoreURLText(context.Background(), target)
+	assert.True(fb.IsValid())
+	assert.Equal(target, fb.ID, "The API should receive the whole target URL")
+	assert.Equal(server.URL+"/v3.2/?access_token=REDACTED&id=https%3A%2F%2Fwww.lectio.com%2Fsearch%3Fq%3Da%26b%3Dc%23results", fb.APIEndpoint)
+}
+
+func TestRedaction(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"Error":"Invalid API key ` + r.URL.Query().Get("apikey") + `","Type":"invalid_api_key"}`))
+	}))
+	scorer := NewSharedCountScorer(staticSharedCountCredentials("top/secret"), server.Client(), UseSharedCountAPI)
+	scorer.BaseURL = server.URL + "/"
+	sc := scorer.scoreURLText(context.Background(), "https://www.lectio.com/")
+	assert.False(sc.IsValid())
+	assert.Contains(sc.APIEndpoint, "apikey=REDACTED")
+
+	server.Close()
+	unreachable := scorer.scoreURLText(context.Background(), "https://www.lectio.com/")
+	assert.Equal(UnableToExecuteHTTPGETRequest, unreachable.ErrorsAndWarnings()[0].IssueCode())
+
+	for _, result := range []*SharedCountLinkScores{sc, unreachable} {
+		serialized, err := json.Marshal(result)
+		assert.NoError(err)
+		assert.NotContains(string(serialized), "top/secret")
+		assert.NotContains(string(serialized), "top%2Fsecret")
+		for _, issue := range result.ErrorsAndWarnings() {
+			assert.NotContains(issue.Issue(), "secret")
+			assert.NotContains(fmt.Sprint(issue.IssueContext()), "secret")
+		}
+	}
+
+	redactor := NewRedactor("token")
+	assert.Equal("https://example.com/?token=REDACTED&url=x", redactor.Endpoint("https://example.com/?url=x&token=abc"))
+	assert.Equal(`Get "https://example.com/?apikey=REDACTED": EOF`, redactor.Text(`Get "https://example.com/?apikey=abc": EOF`))
+
+	redactor.AddSecret(`k&y/"é`)
+	redactor.AddSecret("abc")
+	for _, form := range []string{`k&y/"é`, "k%26y%2F%22%C3%A9", "k&y%2F%22%C3%A9", `k\u0026y/\"é`} {
+		assert.Equal("key REDACTED in a table", redactor.Text("key "+form+" in a table"), form)
+		err := fmt.Errorf("wrapped: %w", errors.New("key "+form))
+		assert.Equal("wrapped: key REDACTED", redactor.Error(err).Error(), form)
+	}
+	assert.Equal("abc is too short to mask", redactor.Text("abc is too short to mask"))
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"Error":"Invalid API key","Type":"invalid_api_key"}`))
+	}))
+	defer server.Close()
+
+	aggregator := NewAggregator(
+		WithHTTPClient(server.Client()),
+		WithFacebook(SimulateFacebookAPI),
+		WithLinkedIn(SimulateLinkedInAPI),
+		WithSharedCount(staticSharedCountCredentials("secret"), UseSharedCountAPI),
+		WithBaseURL(SharedCountScorerMachineName, server.URL+"/"),
+		WithCompositeWeights(CompositeWeights{AnyScorer: {SharesMetric: 1}}))
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	aggregated := aggregator.Aggregate(context.Background(), scoreURL)
+	assert.NotZero(aggregated.Len())
+
+	serialized, err := json.Marshal(aggregated)
+	assert.NoError(err)
+	reloaded := new(AggregatedLinkScores)
+	assert.NoError(json.Unmarshal(serialized, reloaded))
+	assert.Equal(aggregated, reloaded)
+	assert.Equal(aggregated.Len(), reloaded.Len(), "The scorers' issues should be merged back into the aggregate's")
+	var own struct {
+		Issues []json.RawMessage `json:"issues"`
+	}
+	assert.NoError(json.Unmarshal(serialized, &own))
+	assert.Len(own.Issues, 0, "The scorers' issues should only be serialized with their scores")
+	assert.IsType(new(FacebookLinkScores), reloaded.Scores[0])
+	assert.IsType(new(SharedCountLinkScores), reloaded.Scores[2])
+	assert.Equal(APIErrorResponseFound, reloaded.Scores[2].Issues().ErrorsAndWarnings()[0].IssueCode())
+	assert.False(reloaded.IsValid())
+
+	_, err = UnmarshalLinkScores([]byte(`{"scorer":"unknown"}`))
+	assert.Error(err, "Results from unregistered scorers can't be decoded")
+}
+
+func TestIssueSeverities(t *testing.T) {
+	assert := assert.New(t)
+
+	issues := []Issue{
+		NewIssue("test", NoAPIKeyProvidedInCodeOrEnv, "No key", true),
+		NewHTTPResponseIssue("test", http.StatusTooManyRequests, "Too many requests", true),
+		NewIssue("test", UnableToExecuteHTTPGETRequest, "Retrying", false),
+		NewClassifiedIssue("test", APIErrorResponseFound, "Served stale", InfoSeverity, UncategorizedIssue),
+		(FacebookGraphAPIError{Code: 190, Subcode: 460}).issue("test"),
+	}
+	assert.Equal(FatalSeverity, IssueSeverityOf(issues[0]))
+	assert.Equal(AuthIssue, IssueCategoryOf(issues[0]))
+	assert.Equal(QuotaIssue, IssueCategoryOf(issues[1]))
+	assert.Equal(WarningSeverity, IssueSeverityOf(issues[2]))
+	assert.Equal(NetworkIssue, IssueCategoryOf(issues[2]))
+	assert.True(issues[3].IsWarning(), "Info issues are still warnings to callers which only know IsError and IsWarning")
+	assert.False(issues[3].IsError())
+	assert.Equal(AuthIssue, IssueCategoryOf(issues[4]))
+
+	scores := LinkedInLinkScores{IssueCollection: *NewIssueCollection(issues...)}
+	var classified ClassifiedIssues = &scores
+	assert.Len(classified.FilterIssues(ErrorSeverity), 3)
+	assert.Len(classified.FilterIssues(InfoSeverity, AuthIssue), 2)
+	assert.Equal(map[IssueSeverity]uint{FatalSeverity: 1, ErrorSeverity: 2, WarningSeverity: 1, InfoSeverity: 1}, classified.IssueCountsBySeverity())
+	assert.Equal(uint(2), classified.IssueCountsByCategory()[AuthIssue])
+	var fatal int
+	classified.HandleIssuesBySeverity(map[IssueSeverity]func(Issue){FatalSeverity: func(Issue) { fatal++ }})
+	assert.Equal(1, fatal)
+	total, errors, warnings := scores.IssueCounts()
+	assert.Equal([]uint{5, 3, 2}, []uint{total, errors, warnings})
+
+	serialized, _ := json.Marshal(issues[0])
+	assert.Contains(string(serialized), `"severity":"fatal"`)
+	legacy, err := UnmarshalIssue([]byte(`{"context":"test","code":"SCORE_E-0200","message":"Old","isError":true}`))
+	assert.NoError(err)
+	assert.Equal(ErrorSeverity, IssueSeverityOf(legacy), "Issues serialized before severities existed should keep their meaning")
+}
+
+func TestIssueCauses(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	scorer := NewSharedCountScorer(staticSharedCountCredentials("secret"), nil, UseSharedCountAPI)
+	scorer.BaseURL = server.URL + "/"
+	issue := scorer.scoreURLText(context.Background(), "https://www.lectio.com/").ErrorsAndWarnings()[0]
+	err := issue.(error)
+	assert.True(errors.Is(err, IssueCodeError(UnableToExecuteHTTPGETRequest)))
+	assert.True(IsIssueCode(err, UnableToExecuteHTTPGETRequest))
+	assert.False(IsIssueCode(err, RateLimitExceeded))
+	var urlErr *url.Error
+	assert.True(errors.As(err, &urlErr), "The HTTP client's error should be reachable")
+	assert.NotContains(urlErr.URL, "secret", "The wrapped error should be redacted too")
+	var opErr *net.OpError
+	assert.True(errors.As(err, &opErr), "The network error should tell a refused connection from a timeout or DNS failure")
+
+	status := NewHTTPResponseIssue("test", http.StatusBadGateway, "Bad gateway", true).(error)
+	assert.True(IsIssueCode(status, InvalidAPIRespHTTPStatusCode), "Per-status codes should match their base code")
+	assert.True(IsIssueCode(status, InvalidAPIRespHTTPStatusCode+"-HTTP-502"))
+
+	deadline := newContextIssue("test", context.DeadlineExceeded).(error)
+	assert.True(errors.Is(deadline, context.DeadlineExceeded))
+
+	decode := decodeAPIResponseBody("test", []byte(`not json`), new(FacebookLinkScores)).(error)
+	var syntaxErr *json.SyntaxError
+	assert.True(errors.As(decode, &syntaxErr))
+}
+
+func TestIssueCatalog(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, code := range []string{UnableToCreateHTTPRequest, UnableToExecuteHTTPGETRequest, InvalidAPIRespHTTPStatusCode, UnableToReadBodyFromHTTPResponse,
+		APIErrorResponseFound, NoAPIKeyProvidedInCodeOrEnv, SecretManagementError, NoURLProvidedToScorer, ScoringCancelled, ScoringDeadlineExceeded,
+		ScorerPanicked, RateLimitExceeded, ProviderUnavailable, UnableToDecodeAPIResponseBody, UnexpectedAPIResponseBody} {
+		info, ok := LookupIssueCode(code)
+		assert.True(ok, "Every code should be in the catalog: %s", code)
+		assert.NotEmpty(info.Title, code)
+		assert.NotEmpty(info.Description, code)
+		assert.NotEmpty(info.Remediation, code)
+		assert.NotZero(info.Severity, code)
+	}
+	assert.Len(IssueCatalog(), 15)
+
+	info, ok := DescribeIssue(NewHTTPResponseIssue("test", http.StatusTooManyRequests, "Too many requests", true))
+	assert.True(ok, "HTTP-status-derived codes should be described too")
+	assert.Equal("HTTP 429 Too Many Requests", info.Title)
+	assert.Equal(QuotaIssue, info.Category)
+	assert.True(info.Retryable)
+	info, _ = LookupIssueCode(InvalidAPIRespHTTPStatusCode + "-HTTP-404")
+	assert.False(info.Retryable)
+
+	info, _ = LookupIssueCode(NoAPIKeyProvidedInCodeOrEnv)
+	assert.Equal(info.Severity, IssueSeverityOf(NewIssue("test", NoAPIKeyProvidedInCodeOrEnv, "No key", true)), "Issues should get their severity from the catalog")
+
+	_, ok = LookupIssueCode("CUSTOM-0100")
+	assert.False(ok)
+	RegisterIssueCode(IssueCodeInfo{Code: "CUSTOM-0100", Title: "Custom", Severity: ErrorSeverity, Category: QuotaIssue})
+	defer func() {
+		issueCatalog.Lock()
+		delete(issueCatalog.entries, "CUSTOM-0100")
+		issueCatalog.Unlock()
+	}()
+	assert.Equal(QuotaIssue, IssueCategoryOf(NewIssue("test", "CUSTOM-0100", "Custom", true)))
+}
+
+func TestIssueCollection(t *testing.T) {
+	assert := assert.New(t)
+
+	collection := NewIssueCollection()
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			collection.Add(NewIssue("test", UnableToExecuteHTTPGETRequest, "Connection refused", i%2 == 0))
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	total, errors, warnings := collection.IssueCounts()
+	assert.Equal([]uint{10, 5, 5}, []uint{total, errors, warnings})
+	assert.Len(collection.Deduplicated(), 2, "Repeats of the same error and the same warning should collapse")
+
+	aggregated := NewAggregator(
+		WithScorer(&fakeScorer{scores: &LinkedInLinkScores{MachineName: "first", IssueCollection: *NewIssueCollection(
+			NewHTTPResponseIssue("test", http.StatusServiceUnavailable, "Unavailable", true),
+			NewHTTPResponseIssue("test", http.StatusServiceUnavailable, "Unavailable", true))}}),
+		WithScorer(&fakeScorer{scores: &LinkedInLinkScores{MachineName: "second", IssueCollection: *NewIssueCollection(
+			NewIssue("test", UnexpectedAPIResponseBody, "No count", true))}})).Aggregate(context.Background(), nil)
+	assert.Len(aggregated.FromProvider("first"), 2)
+	assert.Len(aggregated.FromProvider("second"), 1)
+	assert.Len(aggregated.WithCode(InvalidAPIRespHTTPStatusCode), 2)
+	assert.Len(aggregated.GroupByCode()[UnexpectedAPIResponseBody], 1)
+	assert.Len(aggregated.Filter(func(i Issue, provider string) bool { return provider == "second" && i.IsError() }), 1)
+	second := aggregated.FromProvider("second")[0]
+	assert.Equal("second", aggregated.ProviderOf(second))
+
+	reloaded := new(IssueCollection)
+	serialized, err := aggregated.IssueCollection.marshalJSON()
+	assert.NoError(err)
+	assert.Contains(string(serialized), `"provider":"second"`)
+	assert.NoError(reloaded.unmarshalJSON(serialized))
+	assert.Len(reloaded.FromProvider("first"), 2, "Which provider raised each issue should survive serialization")
+
+	var racing IssueCollection
+	added := make(chan bool)
+	go func() {
+		time.Sleep(time.Millisecond)
+		racing.Add(NewIssue("test", UnexpectedAPIResponseBody, "No count", true))
+		added <- true
+	}()
+	for racing.Len() == 0 {
+		racing.ErrorsAndWarnings()
+		time.Sleep(10 * time.Microsecond)
+	}
+	<-added
+	assert.Len(racing.ErrorsAndWarnings(), 1, "A zero value collection should be safe to read while it's first added to")
+
+	var zero LinkedInLinkScores
+	assert.True(zero.IsValid())
+	zero.Add(NewIssue("test", UnexpectedAPIResponseBody, "No count", true))
+	assert.Equal(1, zero.Len(), "A zero value result should be ready to collect issues")
+	assert.False(zero.IsValid())
+	copied := zero
+	copied.Add(NewIssue("test", UnexpectedAPIResponseBody, "Still no count", false))
+	assert.Len(zero.IssuesFound(), 2, "Copies of a result should share its issues")
+
+	var decoded FacebookLinkScores
+	assert.NoError(json.Unmarshal([]byte(`{"id":"https://www.lectio.com/"}`), &decoded))
+	decoded.Add(NewIssue("test", UnexpectedAPIResponseBody, "No shares", true))
+	assert.Equal(1, decoded.Len(), "A result decoded from JSON without issues should be ready to collect them")
+}
+
+func TestIssueContext(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"Error":"Invalid API key","Type":"invalid_api_key"}`))
+	}))
+	defer server.Close()
+
+	scorer := NewSharedCountScorer(staticSharedCountCredentials("secret"), server.Client(), UseSharedCountAPI)
+	scorer.BaseURL = server.URL + "/"
+	scorer.Retry = &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	sc := scorer.scoreURLText(context.Background(), "https://www.lectio.com/")
+	issues := sc.ErrorsAndWarnings()
+	assert.Len(issues, 2, "A retry warning and the API's error object, which replaces the final HTTP status")
+
+	retried := issues[0].IssueContext().(IssueContext)
+	assert.Equal(SharedCountScorerMachineName, retried.Provider)
+	assert.Equal("https://www.lectio.com/", retried.TargetURL)
+	assert.Contains(retried.APIEndpoint, "apikey=REDACTED")
+	assert.Equal(1, retried.Attempt)
+	assert.Equal(http.StatusServiceUnavailable, retried.HTTPStatus)
+	assert.True(retried.Latency > 0)
+	assert.False(retried.OccurredAt.IsZero())
+
+	failed := issues[1].IssueContext().(IssueContext)
+	assert.Equal(2, failed.Attempt)
+	assert.Equal(http.StatusUnauthorized, failed.HTTPStatus)
+	assert.Contains(failed.String(), "SharedCount.com https://www.lectio.com/ (attempt 2, HTTP 401")
+
+	limiter := NewRateLimiter(1, 300*time.Millisecond, 1, true)
+	limiter.acquire(context.Background(), "test")
+	started := time.Now()
+	_, throttled := getHTTPResult(context.Background(), newAPICall(server.URL, server.Client(), ProviderPolicies{RateLimiter: limiter}))
+	assert.True(time.Since(started) >= 200*time.Millisecond, "The call should have waited for the rate limiter")
+	assert.True(throttled.IssueContext().(IssueContext).Latency < 200*time.Millisecond, "Waiting for the rate limiter isn't latency")
+
+	original := NewIssue("test", UnexpectedAPIResponseBody, "No count", true)
+	collection := NewIssueCollection(original)
+	collection.finish(LinkedInScorerMachineName, "https://www.lectio.com/", NewRedactor())
+	assert.Equal(LinkedInScorerMachineName, collection.ErrorsAndWarnings()[0].IssueContext().(IssueContext).Provider)
+	assert.Empty(original.IssueContext().(IssueContext).Provider, "Finishing a collection shouldn't change the issues it was given")
+
+	hung := newHungScorer()
+	defer close(hung.release)
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	aggregated := NewAggregator(WithScorer(hung), WithScorerTimeout("hung", 10*time.Millisecond)).Aggregate(context.Background(), scoreURL)
+	timedOut := aggregated.ErrorsAndWarnings()[0].IssueContext().(IssueContext)
+	assert.Equal("hung", timedOut.Provider)
+	assert.Equal("https://www.lectio.com/", timedOut.TargetURL)
+
+	serialized, _ := json.Marshal(issues[1])
+	reloaded, err := UnmarshalIssue(serialized)
+	assert.NoError(err)
+	assert.Equal(failed, reloaded.IssueContext())
+	legacy, err := UnmarshalIssue([]byte(`{"context":"https://graph.facebook.com/?id=x","code":"SCORE_E-0200","message":"Old","isError":true}`))
+	assert.NoError(err)
+	assert.Equal("https://graph.facebook.com/?id=x", legacy.IssueContext().(IssueContext).APIEndpoint)
+}
+
+func TestValidityPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	retried := LinkedInLinkScores{Count: 3, IssueCollection: *NewIssueCollection(NewIssue("test", UnableToExecuteHTTPGETRequest, "Retrying", false))}
+	assert.True(retried.IsValid(), "Warnings shouldn't invalidate scores by default")
+	assert.False(retried.ValidUnder(IssueValidityPolicy{InvalidatingSeverity: WarningSeverity}))
+
+	deprecated := LinkedInLinkScores{MachineName: "deprecated", IssueCollection: *NewIssueCollection(NewHTTPResponseIssue("test", http.StatusGone, "Gone", true))}
+	assert.False(deprecated.IsValid())
+	assert.True(deprecated.ValidUnder(IssueValidityPolicy{IgnoredCodes: []string{InvalidAPIRespHTTPStatusCode}}), "Ignored codes shouldn't invalidate scores")
+
+	hung := newHungScorer()
+	defer close(hung.release)
+	scoreURL, _ := url.Parse("https://www.lectio.com/")
+	newAggregator := func(options ...AggregatorOption) *Aggregator {
+		return NewAggregator(append([]AggregatorOption{
+			WithScorer(&fakeScorer{scores: &LinkedInLinkScores{MachineName: LinkedInScorerMachineName, Count: 3}}),
+			WithScorer(&fakeScorer{scores: &deprecated}),
+			WithScorer(hung),
+			WithScorerTimeout("hung", 10*time.Millisecond),
+		}, options...)...)
+	}
+	aggregated := newAggregator().Aggregate(context.Background(), scoreURL)
+	assert.False(aggregated.IsValid(), "By default every scorer has to be valid")
+	assert.True(aggregated.ValidUnder(QuorumValidityPolicy(1)))
+	assert.False(aggregated.ValidUnder(QuorumValidityPolicy(2)), "Only one scorer returned valid scores")
+	assert.False(aggregated.ValidUnder(QuorumValidityPolicy(4)), "A quorum larger than the number of scorers means all of them")
+
+	aggregated = newAggregator(WithValidityPolicy(QuorumValidityPolicy(1))).Aggregate(context.Background(), scoreURL)
+	assert.True(aggregated.IsValid(), "One flaky provider shouldn't throw away the others' data")
+	assert.Equal(3, aggregated.SharesCount())
+
+	quorate := NewAggregator(
+		WithScorer(&fakeScorer{scores: &LinkedInLinkScores{MachineName: LinkedInScorerMachineName, Count: 3}}),
+		WithScorer(hung),
+		WithScorerTimeout("hung", 10*time.Millisecond),
+		WithValidityPolicy(QuorumValidityPolicy(1))).Aggregate(context.Background(), scoreURL)
+	assert.True(quorate.IsValid())
+	serialized, err := json.Marshal(quorate)
+	assert.NoError(err)
+	reloaded := new(AggregatedLinkScores)
+	assert.NoError(json.Unmarshal(serialized, reloaded))
+	assert.True(reloaded.IsValid(), "The validity policy should survive serialization")
+	assert.Equal(QuorumValidityPolicy(1), reloaded.validity)
+
+	overridden := NewAggregator(WithValidityPolicy(QuorumValidityPolicy(1)),
+		WithProviderPolicies(LinkedInScorerMachineName, ProviderPolicies{Retry: &DefaultRetryPolicy}),
+		WithProviderPolicies(FacebookScorerMachineName, ProviderPolicies{Validity: IssueValidityPolicy{InvalidatingSeverity: WarningSeverity}}))
+	assert.Equal(QuorumValidityPolicy(1), overridden.policiesFor(LinkedInScorerMachineName).Validity, "Per-provider policies should inherit the aggregator's validity policy")
+	assert.Equal(IssueValidityPolicy{InvalidatingSeverity: WarningSeverity}, overridden.policiesFor(FacebookScorerMachineName).Validity)
+
+	lenient := IssueValidityPolicy{Quorum: 2, IgnoredCodes: []string{InvalidAPIRespHTTPStatusCode + "-HTTP-410"}}
+	aggregated = newAggregator(WithValidityPolicy(lenient)).Aggregate(context.Background(), scoreURL)
+	assert.True(aggregated.IsValid(), "Ignoring the deprecated scorer's code should make it count towards the quorum")
+}
@@ -0,0 +1,61 @@
+package score
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// LinkScoresFactory creates an empty LinkScores value which a serialized result can be unmarshalled into
+type LinkScoresFactory func() LinkScores
+
+var linkScoresTypes = struct {
+	sync.RWMutex
+	factories map[string]LinkScoresFactory
+}{factories: make(map[string]LinkScoresFactory)}
+
+func init() {
+	RegisterLinkScoresType(AggregateScorerMachineName, func() LinkScores { return new(AggregatedLinkScores) })
+}
+
+// RegisterLinkScoresType tells UnmarshalLinkScores which type to decode results into when their "scorer" field is
+// machineName, the built-in providers register themselves and custom scorers should do the same
+func RegisterLinkScoresType(machineName string, newScores LinkScoresFactory) {
+	linkScoresTypes.Lock()
+	defer linkScoresTypes.Unlock()
+	if newScores == nil {
+		delete(linkScoresTypes.factories, machineName)
+		return
+	}
+	linkScoresTypes.factories[machineName] = newScores
+}
+
+// UnmarshalLinkScores decodes a serialized result into the concrete type registered for its "scorer" field
+func UnmarshalLinkScores(data []byte) (LinkScores, error) {
+	var header struct {
+		MachineName string `json:"scorer"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	linkScoresTypes.RLock()
+	newScores, ok := linkScoresTypes.factories[header.MachineName]
+	linkScoresTypes.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no LinkScores type registered for scorer %q", header.MachineName)
+	}
+	result := newScores()
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnmarshalIssue decodes a serialized Issue into the package's own Issue implementation
+func UnmarshalIssue(data []byte) (Issue, error) {
+	result := new(issue)
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -1,12 +1,15 @@
 package score
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
 )
 
 // SharedCountAPIKeyEnvVarName is the environment variable which may be expected to contain the API key
@@ -18,10 +21,90 @@ const SimulateSharedCountAPI = true
 // UseSharedCountAPI is passed into GetSharedCountLinkScoresForURLText* if we don't want to simulate the API, but actually run it
 const UseSharedCountAPI = false
 
+// DefaultSharedCountAPIBaseURL is the SharedCount.com API endpoint used when the scorer has no BaseURL
+const DefaultSharedCountAPIBaseURL = "https://api.sharedcount.com/v1.0/"
+
+// SharedCountScorerMachineName is the machine name the SharedCount scorer registers under
+const SharedCountScorerMachineName = "SharedCount.com"
+
+func init() {
+	// SharedCount needs an API key so it's registered but stays disabled until the caller enables it
+	DefaultRegistry.Register(NewSharedCountScorer(EnvSharedCountCredentials{}, nil, UseSharedCountAPI))
+	DefaultRegistry.Disable(SharedCountScorerMachineName)
+	RegisterLinkScoresType(SharedCountScorerMachineName, func() LinkScores { return new(SharedCountLinkScores) })
+}
+
+// SharedCountCredentials supplies the SharedCount.com API key
 type SharedCountCredentials interface {
 	SharedCountAPIKey() (string, bool, Issue)
 }
 
+// EnvSharedCountCredentials reads the SharedCount API key from the SharedCountAPIKeyEnvVarName environment variable
+type EnvSharedCountCredentials struct{}
+
+// SharedCountAPIKey satisfies the SharedCountCredentials interface
+func (c EnvSharedCountCredentials) SharedCountAPIKey() (string, bool, Issue) {
+	apiKey, ok := os.LookupEnv(SharedCountAPIKeyEnvVarName)
+	if !ok || len(apiKey) == 0 {
+		return "", false, NewIssueWithContext(IssueContext{Provider: SharedCountScorerMachineName}, NoAPIKeyProvidedInCodeOrEnv, fmt.Sprintf("SharedCount API key not found in environment variable %q", SharedCountAPIKeyEnvVarName), true, nil)
+	}
+	return apiKey, true, nil
+}
+
+// SharedCountScorer scores links using the SharedCount.com API and satisfies the Scorer interface
+type SharedCountScorer struct {
+	Credentials SharedCountCredentials
+	Client      *http.Client
+	Simulate    bool
+	BaseURL     string // empty means DefaultSharedCountAPIBaseURL, set it to use a test server, proxy or mirror
+	ProviderPolicies
+}
+
+// NewSharedCountScorer creates a SharedCount scorer, a nil client means the package default HTTP client
+func NewSharedCountScorer(creds SharedCountCredentials, client *http.Client, simulateSharedCountAPI bool) *SharedCountScorer {
+	result := new(SharedCountScorer)
+	result.Credentials = creds
+	result.Client = client
+	result.Simulate = simulateSharedCountAPI
+	return result
+}
+
+// MachineName returns the name the scorer is registered under
+func (s *SharedCountScorer) MachineName() string {
+	return SharedCountScorerMachineName
+}
+
+// HumanName returns the display name of the scorer
+func (s *SharedCountScorer) HumanName() string {
+	return "SharedCount.com"
+}
+
+// SensitiveParams satisfies the SensitiveParameters interface
+func (s *SharedCountScorer) SensitiveParams() []string {
+	return []string{"apikey"}
+}
+
+// APIBaseURL returns the base URL the scorer's API calls are made to
+func (s *SharedCountScorer) APIBaseURL() string {
+	if len(s.BaseURL) > 0 {
+		return s.BaseURL
+	}
+	return DefaultSharedCountAPIBaseURL
+}
+
+// ScoreLink satisfies the Lifecycle interface
+func (s *SharedCountScorer) ScoreLink(url *url.URL) (LinkScores, Issue) {
+	return s.ScoreLinkWithContext(context.Background(), url)
+}
+
+// ScoreLinkWithContext satisfies the ContextLifecycle interface
+func (s *SharedCountScorer) ScoreLinkWithContext(ctx context.Context, url *url.URL) (LinkScores, Issue) {
+	if url == nil {
+		return nil, NewIssueWithContext(IssueContext{Provider: s.MachineName()}, NoURLProvidedToScorer, "Null URL passed to SharedCountScorer.ScoreLink", true, nil)
+	}
+	return s.scoreURLText(ctx, url.String()), nil
+}
+
 // SharedCountLinkScores is the type-safe version of what SharedCount.com's API returns
 type SharedCountLinkScores struct {
 	MachineName         string                    `json:"scorer"`
@@ -29,16 +112,19 @@ type SharedCountLinkScores struct {
 	Simulated           bool                      `json:"isSimulated,omitempty"` // part of lectio.score, omitted if it's false
 	URL                 string                    `json:"url"`                   // part of lectio.score
 	APIEndpoint         string                    `json:"apiEndPoint"`           // part of lectio.score
-	IssuesFound         []Issue                   `json:"issues"`                // part of lectio.score
-	AggregatedScore     int                       `json:"aggregated_score"`      // part of lectio.score
-	ErrorFromAPICall    string                    `json:"Error,omitempty"`       // direct mapping to SharedCount API result via Unmarshal httpRes.Body if there's an error
-	ErrorType           string                    `json:"Type,omitempty"`        // direct mapping to SharedCount API result via Unmarshal httpRes.Body if there's an error
-	ErrorHTTPStatusCode int                       `json:"HTTP_Code,omitempty"`   // direct mapping to SharedCount API result via Unmarshal httpRes.Body if there's an error
-	StumbleUpon         int                       `json:"StumbleUpon"`           // direct mapping to SharedCount API result via Unmarshal httpRes.Body
-	Pinterest           int                       `json:"Pinterest"`             // direct mapping to SharedCount API result via Unmarshal httpRes.Body
-	LinkedIn            int                       `json:"LinkedIn"`              // direct mapping to SharedCount API result via Unmarshal httpRes.Body
-	Facebook            SharedCountFacebookScores `json:"Facebook"`              // direct mapping to SharedCount API result via Unmarshal httpRes.Body
-	GooglePlusOne       int                       `json:"GooglePlusOne"`         // direct mapping to SharedCount API result via Unmarshal httpRes.Body
+	APIAttempts         int                       `json:"apiAttempts,omitempty"` // part of lectio.score
+	IssueCollection     `json:"-"`                // part of lectio.score, serialized as "issues" by MarshalJSON
+	AggregatedScore     int                       `json:"aggregated_score"`    // part of lectio.score
+	ErrorFromAPICall    string                    `json:"Error,omitempty"`     // direct mapping to SharedCount API result via Unmarshal httpRes.Body if there's an error
+	ErrorType           string                    `json:"Type,omitempty"`      // direct mapping to SharedCount API result via Unmarshal httpRes.Body if there's an error
+	ErrorHTTPStatusCode int                       `json:"HTTP_Code,omitempty"` // direct mapping to SharedCount API result via Unmarshal httpRes.Body if there's an error
+	StumbleUpon         int                       `json:"StumbleUpon"`         // direct mapping to SharedCount API result via Unmarshal httpRes.Body
+	Pinterest           int                       `json:"Pinterest"`           // direct mapping to SharedCount API result via Unmarshal httpRes.Body
+	LinkedIn            int                       `json:"LinkedIn"`            // direct mapping to SharedCount API result via Unmarshal httpRes.Body
+	Facebook            SharedCountFacebookScores `json:"Facebook"`            // direct mapping to SharedCount API result via Unmarshal httpRes.Body
+	GooglePlusOne       int                       `json:"GooglePlusOne"`       // direct mapping to SharedCount API result via Unmarshal httpRes.Body
+
+	validity ValidityPolicy // nil means DefaultValidityPolicy, serialized as "validity" if it's an IssueValidityPolicy
 }
 
 // SharedCountFacebookScores returns the group of values returned by Facebook API
@@ -60,12 +146,15 @@ func (sc SharedCountLinkScores) TargetURL() string {
 	return sc.URL
 }
 
-// IsValid returns true if the SharedCountLinkScores object is valid (did not return SharedCount error object)
+// IsValid returns true if the SharedCountLinkScores object is valid under the scorer's ValidityPolicy (by default no error
+// Issues, warnings such as retried attempts don't count)
 func (sc SharedCountLinkScores) IsValid() bool {
-	if sc.IssuesFound == nil || len(sc.IssuesFound) == 0 {
-		return true
-	}
-	return false
+	return sc.ValidUnder(sc.validity)
+}
+
+// ValidUnder returns true if the scores are valid under the policy, e.g. to judge reloaded scores differently
+func (sc SharedCountLinkScores) ValidUnder(policy ValidityPolicy) bool {
+	return validityOrDefault(policy).IsValid(&sc.IssueCollection)
 }
 
 // SharesCount is the count of how many times the given URL was shared by this scorer, -1 if invalid or not available
@@ -76,6 +165,23 @@ func (sc SharedCountLinkScores) SharesCount() int {
 	return -1
 }
 
+// networkSharesCount returns how much the network contributed to the aggregated score
+func (sc SharedCountLinkScores) networkSharesCount(network Network) int {
+	switch network {
+	case FacebookNetwork:
+		return sc.Facebook.TotalCount
+	case LinkedInNetwork:
+		return sc.LinkedIn
+	case PinterestNetwork:
+		return sc.Pinterest
+	case StumbleUponNetwork:
+		return sc.StumbleUpon
+	case GooglePlusNetwork:
+		return sc.GooglePlusOne
+	}
+	return 0
+}
+
 // CommentsCount is the count of how many times the given URL was commented on, -1 if invalid or not available
 func (sc SharedCountLinkScores) CommentsCount() int {
 	if sc.IsValid() {
@@ -84,77 +190,112 @@ func (sc SharedCountLinkScores) CommentsCount() int {
 	return -1
 }
 
-// Issues contains all the problems detected in scoring
-func (sc SharedCountLinkScores) Issues() Issues {
-	return sc
+// Metrics returns every per-network count SharedCount reports, empty if invalid
+func (sc SharedCountLinkScores) Metrics() Metrics {
+	if !sc.IsValid() {
+		return nil
+	}
+	return Metrics{
+		countMetric(SharesMetric, FacebookNetwork, sc.Facebook.ShareCount),
+		countMetric(CommentsMetric, FacebookNetwork, sc.Facebook.CommentCount),
+		countMetric(ReactionsMetric, FacebookNetwork, sc.Facebook.ReactionCount),
+		countMetric(CommentPluginMetric, FacebookNetwork, sc.Facebook.CommentPluginCount),
+		countMetric(SharesMetric, LinkedInNetwork, sc.LinkedIn),
+		countMetric(PinsMetric, PinterestNetwork, sc.Pinterest),
+		countMetric(ViewsMetric, StumbleUponNetwork, sc.StumbleUpon),
+		countMetric(PlusOnesMetric, GooglePlusNetwork, sc.GooglePlusOne),
+	}
 }
 
-// ErrorsAndWarnings contains the problems in this link plus satisfies the Link.Issues interface
-func (sc SharedCountLinkScores) ErrorsAndWarnings() []Issue {
-	return sc.IssuesFound
+// finish locates the issues at this scorer and URL and masks credentials so they're never stored or serialized
+func (sc *SharedCountLinkScores) finish(redactor *Redactor) {
+	sc.APIEndpoint = redactor.Endpoint(sc.APIEndpoint)
+	sc.IssueCollection.finish(sc.MachineName, sc.URL, redactor)
+	sc.ErrorFromAPICall = redactor.Text(sc.ErrorFromAPICall)
 }
 
-// IssueCounts returns the total, errors, and warnings counts
-func (sc SharedCountLinkScores) IssueCounts() (uint, uint, uint) {
-	if sc.IssuesFound == nil {
-		return 0, 0, 0
-	}
-	var errors, warnings uint
-	for _, i := range sc.IssuesFound {
-		if i.IsError() {
-			errors++
-		} else {
-			warnings++
-		}
-	}
-	return uint(len(sc.IssuesFound)), errors, warnings
+// MarshalJSON adds the Issues and the validity policy, if it can be serialized, to the serialized scores
+func (sc SharedCountLinkScores) MarshalJSON() ([]byte, error) {
+	type plain SharedCountLinkScores
+	return marshalWithIssues(plain(sc), &sc.IssueCollection, sc.validity)
 }
 
-// HandleIssues loops through each issue and calls a particular handler
-func (sc SharedCountLinkScores) HandleIssues(errorHandler func(Issue), warningHandler func(Issue)) {
-	if sc.IssuesFound == nil {
-		return
-	}
-	for _, i := range sc.IssuesFound {
-		if i.IsError() && errorHandler != nil {
-			errorHandler(i)
-		}
-		if i.IsWarning() && warningHandler != nil {
-			warningHandler(i)
-		}
-	}
+// UnmarshalJSON rebuilds the concrete Issues so that stored results can be reloaded
+func (sc *SharedCountLinkScores) UnmarshalJSON(data []byte) error {
+	type plain SharedCountLinkScores
+	return unmarshalWithIssues(data, (*plain)(sc), &sc.IssueCollection, &sc.validity)
+}
+
+// Issues contains all the problems detected in scoring
+func (sc SharedCountLinkScores) Issues() Issues {
+	return &sc.IssueCollection
 }
 
 // GetSharedCountLinkScoresForURLText takes a text URL to score and returns the SharedCount share count
 func GetSharedCountLinkScoresForURLText(creds SharedCountCredentials, url string, client *http.Client, simulateSharedCountAPI bool) *SharedCountLinkScores {
+	return GetSharedCountLinkScoresForURLTextWithContext(context.Background(), creds, url, client, simulateSharedCountAPI)
+}
+
+// GetSharedCountLinkScoresForURLTextWithContext takes a text URL to score and returns the SharedCount share count, the API call is aborted if ctx is done
+func GetSharedCountLinkScoresForURLTextWithContext(ctx context.Context, creds SharedCountCredentials, url string, client *http.Client, simulateSharedCountAPI bool) *SharedCountLinkScores {
+	return NewSharedCountScorer(creds, client, simulateSharedCountAPI).scoreURLText(ctx, url)
+}
+
+func (s *SharedCountScorer) scoreURLText(ctx context.Context, url string) *SharedCountLinkScores {
 	result := new(SharedCountLinkScores)
-	result.MachineName = "SharedCount.com"
+	result.validity = s.Validity
+	result.MachineName = SharedCountScorerMachineName
 	result.HumanName = "SharedCount.com"
 	result.URL = url
-	if simulateSharedCountAPI {
+	redactor := NewRedactor(s.SensitiveParams()...)
+	defer result.finish(redactor)
+	if ctx.Err() != nil {
+		result.Add(newContextIssue("", ctx.Err()))
+		return result
+	}
+	if s.Simulate {
 		result.Simulated = true
 		result.AggregatedScore = rand.Intn(50)
 		return result
 	}
 
-	apiKey, apiKeyOK, issue := creds.SharedCountAPIKey()
+	if s.Credentials == nil {
+		result.Add(NewIssue("", NoAPIKeyProvidedInCodeOrEnv, "No SharedCount credentials provided", true))
+		return result
+	}
+	apiKey, apiKeyOK, issue := s.Credentials.SharedCountAPIKey()
 	if !apiKeyOK && issue != nil {
-		result.IssuesFound = append(result.IssuesFound, issue)
+		result.Add(issue)
 		return result
 	}
+	redactor.AddSecret(apiKey)
 
-	result.APIEndpoint = fmt.Sprintf("https://api.sharedcount.com/v1.0/?url=%s&apikey=%s", url, apiKey)
-	httpRes, issue := getHTTPResult(result.APIEndpoint, client, HTTPUserAgent)
+	result.APIEndpoint, issue = buildAPIEndpoint(s.APIBaseURL(), map[string]string{"url": url, "apikey": apiKey})
 	if issue != nil {
-		result.IssuesFound = append(result.IssuesFound, issue)
+		result.Add(issue)
+		return result
+	}
+	call := newAPICall(result.APIEndpoint, s.Client, s.ProviderPolicies)
+	call.cacheable = isCacheableSharedCountResponse
+	httpRes, issue := getHTTPResult(ctx, call)
+	result.APIAttempts = httpRes.attempts
+	result.Add(httpRes.issues...)
+	if issue != nil {
+		// error responses (e.g. a bad API key) usually explain themselves better than their HTTP status does
+		if httpRes.body != nil && json.Unmarshal(*httpRes.body, result) == nil && len(result.ErrorFromAPICall) > 0 {
+			issue = inheritAttemptContext(result.apiErrorIssue(), issue)
+		}
+		result.Add(issue)
 		return result
 	}
 	result.APIEndpoint = httpRes.apiEndpoint
-	json.Unmarshal(*httpRes.body, result)
+	if issue := decodeAPIResponseBody(result.APIEndpoint, *httpRes.body, result); issue != nil {
+		result.Add(issue)
+		return result
+	}
 
 	if len(result.ErrorFromAPICall) > 0 {
-		issue := NewIssue(url, APIErrorResponseFound, fmt.Sprintf("SharedCount API returned an error: %q, %q, %d", result.ErrorFromAPICall, result.ErrorType, result.ErrorHTTPStatusCode), true)
-		result.IssuesFound = append(result.IssuesFound, issue)
+		result.Add(result.apiErrorIssue())
 		return result
 	}
 
@@ -167,6 +308,25 @@ func GetSharedCountLinkScoresForURLText(creds SharedCountCredentials, url string
 	return result
 }
 
+// apiErrorIssue converts the SharedCount error fields into an Issue
+func (sc SharedCountLinkScores) apiErrorIssue() Issue {
+	category := httpStatusCategory(sc.ErrorHTTPStatusCode)
+	switch errorType := strings.ToLower(sc.ErrorType); {
+	case strings.Contains(errorType, "key") || strings.Contains(errorType, "auth"):
+		category = AuthIssue
+	case strings.Contains(errorType, "quota") || strings.Contains(errorType, "limit"):
+		category = QuotaIssue
+	}
+	return newAPIErrorIssue(sc.APIEndpoint, sc.ErrorType, "", fmt.Sprintf("SharedCount API returned an error: %q, %q, %d", sc.ErrorFromAPICall, sc.ErrorType, sc.ErrorHTTPStatusCode), true, category)
+}
+
+// isCacheableSharedCountResponse returns true if the body decodes and isn't a SharedCount error
+func isCacheableSharedCountResponse(body []byte) bool {
+	type plain SharedCountLinkScores
+	var payload plain
+	return json.Unmarshal(body, &payload) == nil && len(payload.ErrorFromAPICall) == 0
+}
+
 // GetSharedCountLinkScoresForURL takes a URL to score and returns the SharedCount share count
 func GetSharedCountLinkScoresForURL(creds SharedCountCredentials, url *url.URL, client *http.Client, simulateSharedCountAPI bool) (*SharedCountLinkScores, error) {
 	if url == nil {
@@ -174,3 +334,11 @@ func GetSharedCountLinkScoresForURL(creds SharedCountCredentials, url *url.URL,
 	}
 	return GetSharedCountLinkScoresForURLText(creds, url.String(), client, simulateSharedCountAPI), nil
 }
+
+// GetSharedCountLinkScoresForURLWithContext takes a URL to score and returns the SharedCount share count, the API call is aborted if ctx is done
+func GetSharedCountLinkScoresForURLWithContext(ctx context.Context, creds SharedCountCredentials, url *url.URL, client *http.Client, simulateSharedCountAPI bool) (*SharedCountLinkScores, error) {
+	if url == nil {
+		return nil, errors.New("Null URL passed to GetSharedCountLinkScoresForURLWithContext")
+	}
+	return GetSharedCountLinkScoresForURLTextWithContext(ctx, creds, url.String(), client, simulateSharedCountAPI), nil
+}
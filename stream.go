@@ -0,0 +1,101 @@
+package score
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// URLIterator supplies URLs one at a time, Next returns false when there are no more
+type URLIterator interface {
+	Next() (*url.URL, bool)
+}
+
+// StreamedLinkScores is a single result emitted by StreamLinkScores
+type StreamedLinkScores struct {
+	Index  int        // position of the URL in the input stream
+	URL    *url.URL   // the URL which was scored
+	Scores LinkScores // nil if the scorer returned an Issue instead
+	Issue  Issue      // the Issue returned by the scorer, if any
+}
+
+// Aggregated returns the scores as an aggregate if they were produced by an Aggregator
+func (s StreamedLinkScores) Aggregated() (*AggregatedLinkScores, bool) {
+	aggregated, ok := s.Scores.(*AggregatedLinkScores)
+	return aggregated, ok
+}
+
+// IterateURLs feeds the iterator's URLs into a channel which is closed when the iterator is exhausted or ctx is done
+func IterateURLs(ctx context.Context, iterator URLIterator) <-chan *url.URL {
+	result := make(chan *url.URL)
+	go func() {
+		defer close(result)
+		for {
+			u, ok := iterator.Next()
+			if !ok {
+				return
+			}
+			select {
+			case result <- u:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return result
+}
+
+// StreamLinkScores reads URLs until urls is closed or ctx is done and emits each URL's scores as soon as they're ready,
+// so results may arrive out of order (see Index). At most concurrency URLs are scored at once and nothing more is read
+// while the consumer isn't keeping up. The returned channel is closed once every URL which was read has been handled,
+// URLs which finish scoring after ctx is done aren't emitted.
+func StreamLinkScores(ctx context.Context, scorer Scorer, urls <-chan *url.URL, concurrency int) <-chan StreamedLinkScores {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	result := make(chan StreamedLinkScores)
+	go func() {
+		defer close(result)
+		semaphore := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		for index := 0; ; index++ {
+			var u *url.URL
+			var ok bool
+			select {
+			case u, ok = <-urls:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(index int, u *url.URL) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				scores, issue := scorer.ScoreLinkWithContext(ctx, u)
+				if ctx.Err() != nil {
+					// the consumer has stopped listening, even if the scorer didn't notice
+					return
+				}
+				select {
+				case result <- StreamedLinkScores{Index: index, URL: u, Scores: scores, Issue: issue}:
+				case <-ctx.Done():
+				}
+			}(index, u)
+		}
+	}()
+	return result
+}
+
+// AggregateStream aggregates each URL read from urls and emits the results as soon as they're ready, see StreamLinkScores
+func (a *Aggregator) AggregateStream(ctx context.Context, urls <-chan *url.URL) <-chan StreamedLinkScores {
+	return StreamLinkScores(ctx, a, urls, a.batchConcurrency)
+}
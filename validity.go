@@ -0,0 +1,128 @@
+package score
+
+// ValidityPolicy decides whether scores are valid from their Issues, and aggregates also from their scorers' scores
+type ValidityPolicy interface {
+	IsValid(issues *IssueCollection) bool
+	IsAggregateValid(issues *IssueCollection, scores []LinkScores) bool
+}
+
+// IssueValidityPolicy is the built-in ValidityPolicy, its zero value is DefaultValidityPolicy. It's the only policy
+// results serialize (as their "validity" field), results judged by any other policy are judged by
+// DefaultValidityPolicy once they're reloaded unless ValidUnder is given the policy again
+type IssueValidityPolicy struct {
+	// InvalidatingSeverity is the least severe Issue which invalidates scores, zero means ErrorSeverity so warnings
+	// (e.g. retried attempts) never invalidate, WarningSeverity restores the old behavior of any Issue invalidating
+	InvalidatingSeverity IssueSeverity `json:"invalidatingSeverity,omitempty"`
+
+	// IgnoredCodes never invalidate scores, codes derived from them (e.g. per HTTP status codes) are ignored too
+	IgnoredCodes []string `json:"ignoredCodes,omitempty"`
+
+	// Quorum is how many scorers must return valid scores for an aggregate to be valid, so one flaky provider doesn't
+	// throw away the others' data; zero means all of them, as does a quorum larger than the number of scorers
+	Quorum int `json:"quorum,omitempty"`
+}
+
+// DefaultValidityPolicy is used by results which weren't given a policy: errors invalidate but warnings don't and
+// aggregates need every scorer to be valid
+var DefaultValidityPolicy ValidityPolicy = IssueValidityPolicy{}
+
+// QuorumValidityPolicy makes aggregates valid once quorum scorers return valid scores
+func QuorumValidityPolicy(quorum int) IssueValidityPolicy {
+	return IssueValidityPolicy{Quorum: quorum}
+}
+
+// IsValid returns false if any of the Issues is at or above InvalidatingSeverity and isn't ignored
+func (p IssueValidityPolicy) IsValid(issues *IssueCollection) bool {
+	return len(issues.Filter(func(i Issue, provider string) bool { return p.invalidates(i) })) == 0
+}
+
+// IsAggregateValid requires every scorer's scores and the aggregate's own Issues to be valid, or with a Quorum, at
+// least that many valid scores and no invalidating Issues raised by the aggregate itself
+func (p IssueValidityPolicy) IsAggregateValid(issues *IssueCollection, scores []LinkScores) bool {
+	var valid int
+	for _, s := range scores {
+		if scoresValidUnder(p, s) {
+			valid++
+		}
+	}
+	if p.Quorum <= 0 || p.Quorum > len(scores)+len(p.failedProviders(issues, scores)) {
+		return p.IsValid(issues) && valid == len(scores)
+	}
+	own := issues.Filter(func(i Issue, provider string) bool { return len(provider) == 0 && p.invalidates(i) })
+	return len(own) == 0 && valid >= p.Quorum
+}
+
+func (p IssueValidityPolicy) invalidates(i Issue) bool {
+	minimum := p.InvalidatingSeverity
+	if minimum == 0 {
+		minimum = ErrorSeverity
+	}
+	if IssueSeverityOf(i) < minimum {
+		return false
+	}
+	for _, code := range p.IgnoredCodes {
+		if i.IssueCode() == code || IsIssueCode(asError(i), code) {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidatingIssues returns the Issues which invalidate scores under the policy, for policies other than
+// IssueValidityPolicy that's every Issue at or above ErrorSeverity
+func invalidatingIssues(policy ValidityPolicy, issues *IssueCollection) []Issue {
+	if concrete, ok := serializableValidity(policy); ok {
+		return issues.Filter(func(i Issue, provider string) bool { return concrete.invalidates(i) })
+	}
+	return issues.FilterIssues(ErrorSeverity)
+}
+
+// failedProviders returns the providers which raised Issues but didn't return scores, e.g. because they timed out
+func (p IssueValidityPolicy) failedProviders(issues *IssueCollection, scores []LinkScores) map[string]bool {
+	scored := make(map[string]bool)
+	for _, s := range scores {
+		scored[s.SourceID()] = true
+	}
+	result := make(map[string]bool)
+	issues.Filter(func(i Issue, provider string) bool {
+		if len(provider) > 0 && !scored[provider] {
+			result[provider] = true
+		}
+		return false
+	})
+	return result
+}
+
+// validityUnder is satisfied by the package's result types, which can be judged by any ValidityPolicy
+type validityUnder interface {
+	ValidUnder(policy ValidityPolicy) bool
+}
+
+// scoresValidUnder judges the scores by the policy if they support it, otherwise by their own IsValid
+func scoresValidUnder(policy ValidityPolicy, scores LinkScores) bool {
+	if judged, ok := scores.(validityUnder); ok {
+		return judged.ValidUnder(policy)
+	}
+	return scores.IsValid()
+}
+
+// serializableValidity returns the policy if results can serialize it, i.e. it's an IssueValidityPolicy
+func serializableValidity(policy ValidityPolicy) (IssueValidityPolicy, bool) {
+	switch concrete := policy.(type) {
+	case IssueValidityPolicy:
+		return concrete, true
+	case *IssueValidityPolicy:
+		if concrete != nil {
+			return *concrete, true
+		}
+	}
+	return IssueValidityPolicy{}, false
+}
+
+// validityOrDefault returns DefaultValidityPolicy when the policy is nil
+func validityOrDefault(policy ValidityPolicy) ValidityPolicy {
+	if policy == nil {
+		return DefaultValidityPolicy
+	}
+	return policy
+}